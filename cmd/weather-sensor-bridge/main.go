@@ -7,6 +7,7 @@ import (
 	"sync"
 	"syscall"
 
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/alert"
 	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
 	pub "github.com/geoff-coppertop/weather-sensor-bridge/internal/publisher"
 	sns "github.com/geoff-coppertop/weather-sensor-bridge/internal/sensor"
@@ -29,6 +30,10 @@ func main() {
 
 	log.Debug(cfg)
 
+	if err := wx.CheckTemplates(cfg); err != nil {
+		log.Fatal(err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -36,7 +41,9 @@ func main() {
 
 	snsCh := sns.Start(ctx, &wg)
 
-	wxCh := wx.Start(ctx, &wg, snsCh)
+	wxCh, alertCh := wx.Start(ctx, &wg, cfg, snsCh)
+
+	alert.Start(ctx, &wg, alert.Sinks(cfg), alertCh)
 
 	pubCh := pub.Start(ctx, &wg, cfg, wxCh)
 
@@ -4,7 +4,10 @@ go 1.16
 
 require (
 	github.com/eclipse/paho.golang v0.10.0
+	github.com/fxamacker/cbor/v2 v2.4.0
 	github.com/golang/mock v1.6.0
 	github.com/martinlindhe/unit v0.0.0-20210313160520-19b60e03648d
 	github.com/sirupsen/logrus v1.8.1
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	google.golang.org/protobuf v1.28.1
 )
@@ -2,11 +2,15 @@ package accumulator
 
 import (
 	"container/list"
+	"errors"
 	"fmt"
 	"math"
 	"time"
 )
 
+// ErrNoData is returned when there are no values to calculate statistics from
+var ErrNoData = errors.New("no data accumulated")
+
 type WindowingMethod int
 
 const (
@@ -21,54 +25,83 @@ type Clock interface {
 
 type timestampedValue struct {
 	value     float64
+	tag       float64
 	timestamp time.Time
 }
 
 type Accumulator struct {
-	values *list.List
-	period time.Duration
-	clock  Clock
-	method WindowingMethod
+	values   *list.List
+	period   time.Duration
+	clock    Clock
+	method   WindowingMethod
+	location *time.Location
+	offset   time.Duration
+
+	previous      Stats
+	previousEpoch int64
+	hasPrevious   bool
 }
 
 type Stats struct {
 	Minimum     float64
+	MinimumTag  float64   // tag of the (newest) minimum sample
+	MinimumTime time.Time // time of the (newest) minimum sample
 	Maximum     float64
+	MaximumTag  float64   // tag of the (newest) maximum sample
+	MaximumTime time.Time // time of the (newest) maximum sample
 	PeriodDelta float64
 	Average     float64
+	Span        time.Duration // time from the oldest to the newest sample
+	Slope       float64       // least-squares slope of the samples, per second
+	Integral    float64       // time-weighted sum of the samples joined by straight lines, value-seconds
+	Increase    float64       // sum of the rises from one sample to the next, falls count as nothing
 }
 
 func New(period time.Duration, clock Clock, method WindowingMethod) *Accumulator {
 	acc := Accumulator{
-		values: list.New(),
-		period: period,
-		clock:  clock,
-		method: method,
+		values:   list.New(),
+		period:   period,
+		clock:    clock,
+		method:   method,
+		location: time.UTC,
 	}
 
 	return &acc
 }
 
-func (acc *Accumulator) updateConsective(newVal timestampedValue) error {
-	if acc.values.Len() > 0 {
-		val, err := getValue(acc.values.Back())
-		if err != nil {
-			return err
-		}
+// Align sets where CONSECUTIVE periods start, periods are counted from midnight
+// in location plus offset rather than from midnight UTC. For a daily period
+// with an offset of 9h each period runs from 09:00 to 09:00 local time.
+func (acc *Accumulator) Align(location *time.Location, offset time.Duration) *Accumulator {
+	if location == nil {
+		location = time.UTC
+	}
 
-		/* Start by getting the epoch of the new data and the data at the back
-		 * of the list, which is the second newest. Compare the epochs if they
-		 * are,
-		 *  - the same, add to the list
-		 *  - different, clear the list and then add
-		 * which means all we need to do is check if they're different and clear
-		 * and in both cases we then add to the list. */
-		oldEpoch := acc.calcEpochTime(val.timestamp)
-		newEpoch := acc.calcEpochTime(newVal.timestamp)
-
-		if oldEpoch != newEpoch {
-			acc.values.Init()
-		}
+	acc.location = location
+	acc.offset = offset
+
+	return acc
+}
+
+// Previous returns the statistics of the last CONSECUTIVE period, as they were
+// when it ended. ErrNoData is returned if the last period had no values, or if
+// the period before the current one had no values.
+func (acc *Accumulator) Previous() (Stats, error) {
+	if _, err := acc.Peek(); (err != nil) && (err != ErrNoData) {
+		return Stats{}, err
+	}
+
+	period := int64(acc.period.Seconds())
+	if !acc.hasPrevious || (acc.calcEpochTime(acc.clock.Now())-acc.previousEpoch != period) {
+		return Stats{}, ErrNoData
+	}
+
+	return acc.previous, nil
+}
+
+func (acc *Accumulator) updateConsective(newVal timestampedValue) error {
+	if err := acc.expireConsecutive(newVal.timestamp); err != nil {
+		return err
 	}
 
 	acc.values.PushBack(newVal)
@@ -77,10 +110,18 @@ func (acc *Accumulator) updateConsective(newVal timestampedValue) error {
 }
 
 func (acc *Accumulator) calcEpochTime(timestamp time.Time) int64 {
+	/* Work in local wall clock seconds so that periods follow the location,
+	 * including its daylight saving changes */
+	_, zoneOffset := timestamp.In(acc.location).Zone()
+	wall := timestamp.Unix() + int64(zoneOffset) - int64(acc.offset.Seconds())
+
 	period := int64(acc.period.Seconds())
-	epoch := timestamp.Unix() % period
+	epoch := wall % period
+	if epoch < 0 {
+		epoch += period
+	}
 
-	epoch = timestamp.Unix() - epoch
+	epoch = wall - epoch
 
 	return epoch
 }
@@ -88,15 +129,19 @@ func (acc *Accumulator) calcEpochTime(timestamp time.Time) int64 {
 func (acc *Accumulator) updateRolling(newVal timestampedValue) error {
 	acc.values.PushBack(newVal)
 
-	/* Pop elements off of the front of the list until the list only goes back
-	 * period time from the newest value */
-	for {
+	return acc.expireRolling(newVal.timestamp)
+}
+
+/* Pop elements off of the front of the list until the list only goes back
+ * period time from now */
+func (acc *Accumulator) expireRolling(now time.Time) error {
+	for acc.values.Len() > 0 {
 		val, err := getValue(acc.values.Front())
 		if err != nil {
 			return err
 		}
 
-		if val.timestamp.Before(newVal.timestamp.Add(-acc.period)) {
+		if val.timestamp.Before(now.Add(-acc.period)) {
 			acc.values.Remove(acc.values.Front())
 		} else {
 			break
@@ -106,7 +151,65 @@ func (acc *Accumulator) updateRolling(newVal timestampedValue) error {
 	return nil
 }
 
+func (acc *Accumulator) expireConsecutive(now time.Time) error {
+	if acc.values.Len() == 0 {
+		return nil
+	}
+
+	val, err := getValue(acc.values.Back())
+	if err != nil {
+		return err
+	}
+
+	/* Start by getting the epoch of now and the data at the back of the list,
+	 * which is the newest. Compare the epochs if they are,
+	 *  - the same, keep the list
+	 *  - different, clear the list
+	 * so that anything added afterwards starts a fresh period. */
+	oldEpoch := acc.calcEpochTime(val.timestamp)
+	newEpoch := acc.calcEpochTime(now)
+
+	if oldEpoch != newEpoch {
+		/* Hang on to the period that is ending */
+		if acc.previous, err = acc.calculateStats(); err != nil {
+			return err
+		}
+		acc.previousEpoch = oldEpoch
+		acc.hasPrevious = true
+
+		acc.values.Init()
+	}
+
+	return nil
+}
+
+// Peek returns the statistics of the values in the window as of now without
+// adding a new value, ErrNoData is returned if the window is empty
+func (acc *Accumulator) Peek() (Stats, error) {
+	now := acc.clock.Now()
+
+	var err error
+
+	switch acc.method {
+	case ROLLING:
+		err = acc.expireRolling(now)
+
+	case CONSECUTIVE:
+		err = acc.expireConsecutive(now)
+	}
+
+	if err != nil {
+		return Stats{}, err
+	}
+
+	return acc.calculateStats()
+}
+
 func (acc *Accumulator) calculateStats() (Stats, error) {
+	if acc.values.Len() == 0 {
+		return Stats{}, ErrNoData
+	}
+
 	stat := Stats{
 		Minimum:     math.MaxFloat64,
 		Maximum:     -math.MaxFloat64,
@@ -121,12 +224,16 @@ func (acc *Accumulator) calculateStats() (Stats, error) {
 			return Stats{}, err
 		}
 
-		if val.value > stat.Maximum {
+		if val.value >= stat.Maximum {
 			stat.Maximum = val.value
+			stat.MaximumTag = val.tag
+			stat.MaximumTime = val.timestamp
 		}
 
-		if val.value < stat.Minimum {
+		if val.value <= stat.Minimum {
 			stat.Minimum = val.value
+			stat.MinimumTag = val.tag
+			stat.MinimumTime = val.timestamp
 		}
 
 		stat.Average += val.value
@@ -147,13 +254,63 @@ func (acc *Accumulator) calculateStats() (Stats, error) {
 	}
 
 	stat.PeriodDelta = end.value - start.value
+	stat.Span = end.timestamp.Sub(start.timestamp)
+
+	/* Fit a line through the samples, time is taken from the first sample to
+	 * keep the numbers small. Without any spread in time there is no slope. */
+	var meanTime float64
+	for e := acc.values.Front(); e != nil; e = e.Next() {
+		val, err := getValue(e)
+		if err != nil {
+			return Stats{}, err
+		}
+
+		meanTime += val.timestamp.Sub(start.timestamp).Seconds()
+	}
+	meanTime /= float64(acc.values.Len())
+
+	var covariance, variance float64
+	last := start
+	for e := acc.values.Front(); e != nil; e = e.Next() {
+		val, err := getValue(e)
+		if err != nil {
+			return Stats{}, err
+		}
+
+		dt := val.timestamp.Sub(start.timestamp).Seconds() - meanTime
+
+		covariance += dt * (val.value - stat.Average)
+		variance += dt * dt
+
+		/* Trapezoids between each pair of samples */
+		stat.Integral += (last.value + val.value) / 2 * val.timestamp.Sub(last.timestamp).Seconds()
+
+		/* A counter that falls has been reset, it starts again from there */
+		if val.value > last.value {
+			stat.Increase += val.value - last.value
+		}
+
+		last = val
+	}
+
+	if variance > 0 {
+		stat.Slope = covariance / variance
+	}
 
 	return stat, nil
 }
 
 func (acc *Accumulator) Accumulate(val float64) (Stats, error) {
+	return acc.AccumulateTagged(val, 0)
+}
+
+// AccumulateTagged accumulates val along with a tag that rides with it, this
+// lets us find out something else about the sample that was the min/max, such
+// as the wind direction at the time of the strongest gust
+func (acc *Accumulator) AccumulateTagged(val float64, tag float64) (Stats, error) {
 	newVal := timestampedValue{
 		value:     val,
+		tag:       tag,
 		timestamp: acc.clock.Now(),
 	}
 
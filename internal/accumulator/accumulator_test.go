@@ -2,6 +2,7 @@
 package accumulator
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -123,3 +124,279 @@ func TestConsecutiveWindow(t *testing.T) {
 		}
 	}
 }
+
+func TestTaggedWindow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := realClock{}.Now()
+	idx := 0
+
+	testData := []struct {
+		input  float64
+		tag    float64
+		delay  time.Duration
+		output Stats
+	}{
+		{1.0, 10.0, 0 * time.Second, Stats{Maximum: 1.0, MaximumTag: 10.0, Minimum: 1.0, MinimumTag: 10.0, Span: 0 * time.Second}},
+		{3.0, 20.0, 5 * time.Second, Stats{Maximum: 3.0, MaximumTag: 20.0, Minimum: 1.0, MinimumTag: 10.0, Span: 5 * time.Second}},
+		{1.0, 30.0, 5 * time.Second, Stats{Maximum: 3.0, MaximumTag: 20.0, Minimum: 1.0, MinimumTag: 30.0, Span: 10 * time.Second}},
+		{2.0, 40.0, 10 * time.Second, Stats{Maximum: 2.0, MaximumTag: 40.0, Minimum: 1.0, MinimumTag: 30.0, Span: 10 * time.Second}},
+	}
+
+	clk := mocks.NewMockClock(ctrl)
+	clk.
+		EXPECT().
+		Now().
+		DoAndReturn(
+			func() time.Time {
+				now = now.Add(testData[idx].delay)
+				idx++
+				return now
+			},
+		).
+		Times(len(testData))
+
+	period, _ := time.ParseDuration("10s")
+	acc := New(period, clk, ROLLING)
+
+	for _, test := range testData {
+		stat, err := acc.AccumulateTagged(test.input, test.tag)
+
+		if err != nil {
+			t.Error("")
+		}
+
+		if stat.Minimum != test.output.Minimum || stat.MinimumTag != test.output.MinimumTag {
+			t.Errorf("expected minimum %v (%v), got %v (%v)", test.output.Minimum, test.output.MinimumTag, stat.Minimum, stat.MinimumTag)
+		}
+		if stat.Maximum != test.output.Maximum || stat.MaximumTag != test.output.MaximumTag {
+			t.Errorf("expected maximum %v (%v), got %v (%v)", test.output.Maximum, test.output.MaximumTag, stat.Maximum, stat.MaximumTag)
+		}
+		if stat.Span != test.output.Span {
+			t.Errorf("expected span %v, got %v", test.output.Span, stat.Span)
+		}
+	}
+}
+
+func TestPeek(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := realClock{}.Now()
+
+	clk := mocks.NewMockClock(ctrl)
+	clk.
+		EXPECT().
+		Now().
+		DoAndReturn(
+			func() time.Time {
+				return now
+			},
+		).
+		AnyTimes()
+
+	period, _ := time.ParseDuration("10s")
+	acc := New(period, clk, ROLLING)
+
+	if _, err := acc.Peek(); err != ErrNoData {
+		t.Errorf("expected no data, got %v", err)
+	}
+
+	acc.Accumulate(1.0)
+	now = now.Add(5 * time.Second)
+	acc.Accumulate(3.0)
+
+	stat, err := acc.Peek()
+	if err != nil {
+		t.Errorf("unexpected error, got %v", err)
+	}
+	if stat.Average != 2.0 {
+		t.Errorf("expected average 2, got %v", stat.Average)
+	}
+
+	/* Peeking must not add a value */
+	if stat, _ = acc.Peek(); stat.Average != 2.0 {
+		t.Errorf("expected average 2, got %v", stat.Average)
+	}
+
+	now = now.Add(6 * time.Second)
+	if stat, _ = acc.Peek(); stat.Average != 3.0 {
+		t.Errorf("expected the first value to expire, got %v", stat.Average)
+	}
+
+	now = now.Add(10 * time.Second)
+	if _, err := acc.Peek(); err != ErrNoData {
+		t.Errorf("expected all values to expire, got %v", err)
+	}
+}
+
+func TestAlignedPrevious(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	loc := time.FixedZone("test", -5*60*60)
+	now := time.Date(2021, 7, 23, 8, 0, 0, 0, loc)
+
+	clk := mocks.NewMockClock(ctrl)
+	clk.
+		EXPECT().
+		Now().
+		DoAndReturn(
+			func() time.Time {
+				return now
+			},
+		).
+		AnyTimes()
+
+	/* Days run from 09:00 to 09:00 local time */
+	acc := New(24*time.Hour, clk, CONSECUTIVE).Align(loc, 9*time.Hour)
+
+	acc.Accumulate(20.0)
+	minTime := now
+
+	now = now.Add(30 * time.Minute)
+	acc.Accumulate(25.0)
+	maxTime := now
+
+	if _, err := acc.Previous(); err != ErrNoData {
+		t.Errorf("expected no previous period, got %v", err)
+	}
+
+	/* 09:30 is the next day */
+	now = now.Add(time.Hour)
+	stat, err := acc.Accumulate(22.0)
+	if err != nil || stat.Minimum != 22.0 || stat.Maximum != 22.0 {
+		t.Errorf("expected a new period, got %v (%v)", stat, err)
+	}
+
+	prev, err := acc.Previous()
+	if err != nil {
+		t.Errorf("unexpected error, got %v", err)
+	}
+	if prev.Minimum != 20.0 || !prev.MinimumTime.Equal(minTime) {
+		t.Errorf("expected minimum 20 at %v, got %v at %v", minTime, prev.Minimum, prev.MinimumTime)
+	}
+	if prev.Maximum != 25.0 || !prev.MaximumTime.Equal(maxTime) {
+		t.Errorf("expected maximum 25 at %v, got %v at %v", maxTime, prev.Maximum, prev.MaximumTime)
+	}
+
+	/* Two days on, yesterday had no values */
+	now = now.Add(48 * time.Hour)
+	if _, err := acc.Previous(); err != ErrNoData {
+		t.Errorf("expected no previous period, got %v", err)
+	}
+}
+
+func TestSlope(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := realClock{}.Now()
+
+	clk := mocks.NewMockClock(ctrl)
+	clk.
+		EXPECT().
+		Now().
+		DoAndReturn(
+			func() time.Time {
+				return now
+			},
+		).
+		AnyTimes()
+
+	acc := New(time.Hour, clk, ROLLING)
+
+	/* A single sample has no slope */
+	stat, _ := acc.Accumulate(10.0)
+	if stat.Slope != 0 {
+		t.Errorf("expected no slope, got %v", stat.Slope)
+	}
+
+	/* Noise either side of a line rising 1 per minute, with a dip at the end
+	 * so that the ends alone suggest it is falling */
+	for i, noise := range []float64{-2, 2, -2, 2, -2, 2, -2, 2, -2, -12} {
+		now = now.Add(time.Minute)
+		stat, _ = acc.Accumulate(10.0 + float64(i+1) + noise)
+	}
+
+	if stat.PeriodDelta != -2.0 {
+		t.Errorf("expected period delta -2, got %v", stat.PeriodDelta)
+	}
+
+	if math.Abs(stat.Slope*60-5.0/11) > 1e-9 {
+		t.Errorf("expected slope 5/11 per minute, got %v", stat.Slope*60)
+	}
+}
+
+func TestIntegral(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := realClock{}.Now()
+
+	clk := mocks.NewMockClock(ctrl)
+	clk.
+		EXPECT().
+		Now().
+		DoAndReturn(
+			func() time.Time {
+				return now
+			},
+		).
+		AnyTimes()
+
+	acc := New(time.Hour, clk, ROLLING)
+
+	stat, _ := acc.Accumulate(2.0)
+	if stat.Integral != 0 {
+		t.Errorf("expected no integral, got %v", stat.Integral)
+	}
+
+	/* Unevenly spaced samples are weighted by the time between them, where the
+	 * average would not be */
+	now = now.Add(10 * time.Second)
+	acc.Accumulate(4.0)
+	now = now.Add(50 * time.Second)
+	stat, _ = acc.Accumulate(4.0)
+
+	if stat.Integral != 230 {
+		t.Errorf("expected integral 230, got %v", stat.Integral)
+	}
+}
+
+func TestIncrease(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := realClock{}.Now()
+
+	clk := mocks.NewMockClock(ctrl)
+	clk.
+		EXPECT().
+		Now().
+		DoAndReturn(
+			func() time.Time {
+				return now
+			},
+		).
+		AnyTimes()
+
+	acc := New(time.Hour, clk, ROLLING)
+
+	/* The counter is reset after 3, what it counts from then on still adds
+	 * up where the delta would go backwards */
+	var stat Stats
+	for _, val := range []float64{1.0, 2.0, 3.0, 0.0, 0.5} {
+		stat, _ = acc.Accumulate(val)
+		now = now.Add(time.Minute)
+	}
+
+	if stat.Increase != 2.5 {
+		t.Errorf("expected increase 2.5, got %v", stat.Increase)
+	}
+
+	if stat.PeriodDelta != -0.5 {
+		t.Errorf("expected delta -0.5, got %v", stat.PeriodDelta)
+	}
+}
@@ -0,0 +1,234 @@
+package alert
+
+import (
+	"fmt"
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+	mh "github.com/geoff-coppertop/weather-sensor-bridge/internal/maphelper"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/math"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/units"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	Raised  = "raised"
+	Cleared = "cleared"
+
+	// AnySensor is the rule sensor that matches every sensor
+	AnySensor = "*"
+)
+
+// Alert is a rule being raised or cleared for a sensor
+type Alert struct {
+	Rule      string    `json:"rule"`
+	Sensor    string    `json:"sensor"`
+	State     string    `json:"state"`
+	Field     string    `json:"field,omitempty"`
+	Value     *float64  `json:"value,omitempty"`
+	Threshold float64   `json:"threshold"`
+	Time      time.Time `json:"time"`
+	Message   string    `json:"message"`
+}
+
+// ruleState is where a rule is at for a single sensor
+type ruleState struct {
+	active  bool
+	pending time.Time // when the condition started to hold, zero if it doesn't
+	raised  time.Time // when the alert was last raised
+}
+
+// Engine evaluates the alert rules against the data of each sensor
+type Engine struct {
+	rules    map[string]cfg.AlertRule
+	clock    acc.Clock
+	states   map[string]*ruleState
+	lastSeen map[string]time.Time
+}
+
+// New creates an engine for the rules, keyed by name
+func New(rules map[string]cfg.AlertRule, clock acc.Clock) *Engine {
+	engine := Engine{
+		rules:    rules,
+		clock:    clock,
+		states:   make(map[string]*ruleState),
+		lastSeen: make(map[string]time.Time),
+	}
+
+	return &engine
+}
+
+func (e *Engine) state(name string, sensor string) *ruleState {
+	key := name + "/" + sensor
+
+	state, ok := e.states[key]
+	if !ok {
+		state = &ruleState{}
+		e.states[key] = state
+	}
+
+	return state
+}
+
+func applies(rule cfg.AlertRule, sensor string) bool {
+	return (rule.Sensor == AnySensor) || (rule.Sensor == sensor)
+}
+
+// Update evaluates the field rules that apply to the sensor against its data,
+// and clears any offline alerts for it. The alerts raised or cleared are
+// returned.
+func (e *Engine) Update(sensor string, data map[string]interface{}) []Alert {
+	now := e.clock.Now()
+	e.lastSeen[sensor] = now
+
+	var alerts []Alert
+
+	for name, rule := range e.rules {
+		if !applies(rule, sensor) {
+			continue
+		}
+
+		state := e.state(name, sensor)
+
+		if rule.Offline > 0 {
+			if state.active {
+				state.active = false
+				alerts = append(alerts, newAlert(name, sensor, Cleared, rule, nil, now))
+			}
+			continue
+		}
+
+		value, ok := mh.GetFloatValue(data, rule.Field)
+		if !ok {
+			continue
+		}
+
+		if a, changed := e.evaluate(name, sensor, rule, state, value, now); changed {
+			alerts = append(alerts, a)
+		}
+	}
+
+	return alerts
+}
+
+// Check raises the offline alerts of sensors that have gone quiet, it should
+// be called regularly
+func (e *Engine) Check() []Alert {
+	now := e.clock.Now()
+
+	var alerts []Alert
+
+	for name, rule := range e.rules {
+		if rule.Offline <= 0 {
+			continue
+		}
+
+		for sensor, seen := range e.lastSeen {
+			if !applies(rule, sensor) {
+				continue
+			}
+
+			state := e.state(name, sensor)
+			if state.active || (now.Sub(seen) < minutes(rule.Offline)) || !cooledDown(rule, state, now) {
+				continue
+			}
+
+			state.active = true
+			state.raised = now
+			alerts = append(alerts, newAlert(name, sensor, Raised, rule, nil, now))
+		}
+	}
+
+	return alerts
+}
+
+func (e *Engine) evaluate(name string, sensor string, rule cfg.AlertRule, state *ruleState, value float64, now time.Time) (Alert, bool) {
+	if state.active {
+		/* Only clear once the value is back past the threshold by the
+		 * hysteresis, so that it doesn't flap */
+		clear := false
+		if rule.Above != nil {
+			clear = value < *rule.Above-rule.Hysteresis
+		} else {
+			clear = value > *rule.Below+rule.Hysteresis
+		}
+
+		if !clear {
+			return Alert{}, false
+		}
+
+		state.active = false
+		state.pending = time.Time{}
+
+		return newAlert(name, sensor, Cleared, rule, &value, now), true
+	}
+
+	met := false
+	if rule.Above != nil {
+		met = value > *rule.Above
+	} else {
+		met = value < *rule.Below
+	}
+
+	if !met {
+		state.pending = time.Time{}
+		return Alert{}, false
+	}
+
+	if state.pending.IsZero() {
+		state.pending = now
+	}
+
+	if (now.Sub(state.pending) < minutes(rule.Duration)) || !cooledDown(rule, state, now) {
+		return Alert{}, false
+	}
+
+	state.active = true
+	state.raised = now
+
+	return newAlert(name, sensor, Raised, rule, &value, now), true
+}
+
+func cooledDown(rule cfg.AlertRule, state *ruleState, now time.Time) bool {
+	return state.raised.IsZero() || (now.Sub(state.raised) >= minutes(rule.Cooldown))
+}
+
+func minutes(m int) time.Duration {
+	return time.Duration(m) * time.Minute
+}
+
+func newAlert(name string, sensor string, state string, rule cfg.AlertRule, value *float64, now time.Time) Alert {
+	/* Values are published to the decimals they would be in metric */
+	if value != nil {
+		rounded := math.Round(*value, units.DefaultPrecision)
+		value = &rounded
+	}
+
+	a := Alert{
+		Rule:   name,
+		Sensor: sensor,
+		State:  state,
+		Field:  rule.Field,
+		Value:  value,
+		Time:   now,
+	}
+
+	switch {
+	case rule.Offline > 0:
+		a.Threshold = float64(rule.Offline)
+		a.Message = fmt.Sprintf("%s %s: %s has not been heard from for %d minutes", name, state, sensor, rule.Offline)
+
+	case rule.Above != nil:
+		a.Threshold = *rule.Above
+		a.Message = fmt.Sprintf("%s %s: %s %s is %.2f, the limit is above %.2f", name, state, sensor, rule.Field, *value, *rule.Above)
+
+	default:
+		a.Threshold = *rule.Below
+		a.Message = fmt.Sprintf("%s %s: %s %s is %.2f, the limit is below %.2f", name, state, sensor, rule.Field, *value, *rule.Below)
+	}
+
+	log.Info(a.Message)
+
+	return a
+}
@@ -0,0 +1,107 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func threshold(val float64) *float64 {
+	return &val
+}
+
+func TestThreshold(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	rules := map[string]cfg.AlertRule{
+		"frost": {Sensor: AnySensor, Field: "temp", Below: threshold(1), Hysteresis: 0.5, Duration: 5, Cooldown: 60},
+	}
+
+	engine := New(rules, clk)
+
+	var tests = []struct {
+		minutes int
+		temp    float64
+		state   string
+	}{
+		{0, 2, ""},
+		/* Has to stay below for 5 minutes */
+		{1, 0.5, ""},
+		{3, 2, ""},
+		{4, 0.5, ""},
+		{9, 0.5, Raised},
+		{10, 0, ""},
+		/* Hysteresis */
+		{11, 1.2, ""},
+		{12, 1.6, Cleared},
+		/* Cooldown, an hour from when it was raised */
+		{13, 0, ""},
+		{30, 0, ""},
+		{69, 0, Raised},
+	}
+
+	for _, test := range tests {
+		clk.now = time.Unix(0, 0).Add(time.Duration(test.minutes) * time.Minute)
+
+		alerts := engine.Update("model/1", map[string]interface{}{"temp": test.temp})
+
+		if test.state == "" {
+			if len(alerts) != 0 {
+				t.Errorf("%d minutes: expected no alerts, got %v", test.minutes, alerts)
+			}
+			continue
+		}
+
+		if len(alerts) != 1 || alerts[0].State != test.state {
+			t.Errorf("%d minutes: expected %s, got %v", test.minutes, test.state, alerts)
+			continue
+		}
+
+		if a := alerts[0]; a.Rule != "frost" || a.Sensor != "model/1" || *a.Value != test.temp || a.Threshold != 1 {
+			t.Errorf("%d minutes: unexpected alert %v", test.minutes, a)
+		}
+	}
+}
+
+func TestOffline(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	rules := map[string]cfg.AlertRule{
+		"offline": {Sensor: "model/1", Offline: 30},
+		"gust":    {Sensor: "model/2", Field: "wspd_gust", Above: threshold(20)},
+	}
+
+	engine := New(rules, clk)
+
+	engine.Update("model/1", map[string]interface{}{"temp": 20.0})
+
+	/* Gusts on other sensors don't count */
+	if alerts := engine.Update("model/1", map[string]interface{}{"wspd_gust": 30.0}); len(alerts) != 0 {
+		t.Errorf("expected no alerts, got %v", alerts)
+	}
+
+	clk.now = clk.now.Add(29 * time.Minute)
+	if alerts := engine.Check(); len(alerts) != 0 {
+		t.Errorf("expected no alerts, got %v", alerts)
+	}
+
+	clk.now = clk.now.Add(time.Minute)
+	if alerts := engine.Check(); len(alerts) != 1 || alerts[0].State != Raised || alerts[0].Value != nil {
+		t.Errorf("expected the sensor to be offline, got %v", alerts)
+	}
+
+	/* Only raised once */
+	clk.now = clk.now.Add(time.Minute)
+	if alerts := engine.Check(); len(alerts) != 0 {
+		t.Errorf("expected no alerts, got %v", alerts)
+	}
+
+	if alerts := engine.Update("model/1", map[string]interface{}{}); len(alerts) != 1 || alerts[0].State != Cleared {
+		t.Errorf("expected the sensor to be back, got %v", alerts)
+	}
+}
@@ -0,0 +1,208 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const sinkTimeout = 10 * time.Second
+
+// Sink delivers alerts somewhere outside of MQTT
+type Sink interface {
+	Send(a Alert) error
+}
+
+// Webhook posts each alert as JSON to a URL
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhook creates a webhook sink posting to url
+func NewWebhook(url string) *Webhook {
+	webhook := Webhook{
+		url:    url,
+		client: &http.Client{Timeout: sinkTimeout},
+	}
+
+	return &webhook
+}
+
+func (w *Webhook) Send(a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if (resp.StatusCode < 200) || (resp.StatusCode > 299) {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
+
+// SMTP mails each alert
+type SMTP struct {
+	addr    string
+	auth    smtp.Auth
+	from    string
+	to      []string
+	timeout time.Duration // for the whole conversation with the server
+}
+
+// NewSMTP creates a mail sink, the server URL's user info is used to log in
+// when it is there
+func NewSMTP(config cfg.SMTP) *SMTP {
+	sink := SMTP{
+		addr:    config.URL.Host,
+		from:    config.From,
+		to:      config.To,
+		timeout: sinkTimeout,
+	}
+
+	if user := config.URL.User; user != nil {
+		password, _ := user.Password()
+		sink.auth = smtp.PlainAuth("", user.Username(), password, config.URL.Hostname())
+	}
+
+	return &sink
+}
+
+func (s *SMTP) Send(a Alert) error {
+	var msg strings.Builder
+
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: Weather alert %s %s\r\n", a.Rule, a.State)
+	fmt.Fprintf(&msg, "Date: %s\r\n", a.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&msg, "\r\n%s\r\n", a.Message)
+
+	return s.send([]byte(msg.String()))
+}
+
+// send is smtp.SendMail with a deadline, so that a server that stops answering
+// can't hold up the alerts
+func (s *SMTP) send(msg []byte) error {
+	conn, err := net.DialTimeout("tcp", s.addr, s.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if s.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("smtp server doesn't support AUTH")
+		}
+		if err := c.Auth(s.auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(s.from); err != nil {
+		return err
+	}
+
+	for _, addr := range s.to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// Sinks returns the sinks that are configured
+func Sinks(config cfg.Config) []Sink {
+	var sinks []Sink
+
+	if config.AlertWebhook != nil {
+		sinks = append(sinks, NewWebhook(config.AlertWebhook.String()))
+	}
+
+	if config.AlertSMTP != nil {
+		sinks = append(sinks, NewSMTP(*config.AlertSMTP))
+	}
+
+	return sinks
+}
+
+// Start delivers the alerts from in to each of the sinks, until the context is
+// done
+func Start(ctx context.Context, wg *sync.WaitGroup, sinks []Sink, in <-chan Alert) {
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case a, ok := <-in:
+				if !ok {
+					return
+				}
+
+				for _, sink := range sinks {
+					if err := sink.Send(a); err != nil {
+						log.Errorf("error sending alert: %v", err)
+					}
+				}
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,197 @@
+package alert
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+)
+
+func testAlert() Alert {
+	value := 0.5
+
+	return Alert{
+		Rule:      "frost",
+		Sensor:    "model/1",
+		State:     Raised,
+		Field:     "temp",
+		Value:     &value,
+		Threshold: 1,
+		Time:      time.Date(2021, 7, 23, 5, 0, 0, 0, time.UTC),
+		Message:   "frost raised",
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	received := make(chan Alert, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a Alert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- a
+	}))
+	defer server.Close()
+
+	if err := NewWebhook(server.URL).Send(testAlert()); err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	if a := <-received; a.Rule != "frost" || a.State != Raised || *a.Value != 0.5 {
+		t.Errorf("unexpected alert %v", a)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	if err := NewWebhook(failing.URL).Send(testAlert()); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+// fakeSMTP accepts a single mail and hands back what was sent
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail := make(chan string, 1)
+
+	go func() {
+		defer listener.Close()
+
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) {
+			conn.Write([]byte(s + "\r\n"))
+		}
+
+		var transcript strings.Builder
+
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+
+			case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+				transcript.WriteString(line)
+				reply("250 OK")
+
+			case cmd == "DATA":
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					transcript.WriteString(line)
+				}
+				reply("250 OK")
+
+			case cmd == "QUIT":
+				reply("221 bye")
+				mail <- transcript.String()
+				return
+
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	return listener.Addr().String(), mail
+}
+
+func TestSMTP(t *testing.T) {
+	addr, mail := fakeSMTP(t)
+
+	sink := NewSMTP(cfg.SMTP{
+		URL:  &url.URL{Scheme: "smtp", Host: addr},
+		From: "weather@example.com",
+		To:   []string{"a@example.com", "b@example.com"},
+	})
+
+	if err := sink.Send(testAlert()); err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	sent := <-mail
+
+	expected := []string{
+		"MAIL FROM:<weather@example.com>",
+		"RCPT TO:<a@example.com>",
+		"RCPT TO:<b@example.com>",
+		"Subject: Weather alert frost raised",
+		"frost raised",
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(sent, e) {
+			t.Errorf("expected %q in %q", e, sent)
+		}
+	}
+}
+
+func TestSMTPTimeout(t *testing.T) {
+	/* A server that accepts the connection but never answers */
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		io.ReadAll(conn)
+	}()
+
+	sink := NewSMTP(cfg.SMTP{
+		URL:  &url.URL{Scheme: "smtp", Host: listener.Addr().String()},
+		From: "weather@example.com",
+		To:   []string{"a@example.com"},
+	})
+	sink.timeout = 100 * time.Millisecond
+
+	start := time.Now()
+
+	if err := sink.Send(testAlert()); err == nil {
+		t.Errorf("expected an error")
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the send to give up after its timeout, took %v", elapsed)
+	}
+}
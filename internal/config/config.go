@@ -1,13 +1,22 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"os"
 
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/encoder"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/homeassistant"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/homie"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/payload"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/render"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/topic"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/units"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -18,6 +27,85 @@ const (
 	envServerURL         = "SERVER_URL" // MQTT server URL
 	envKeepAlive         = "KA_TIME"    // seconds between keepalive packets
 	envConnectRetryDelay = "CRD_TIME"   // milliseconds to delay between connection attempts
+
+	envRainEventDryTime = "RAIN_EVENT_DRY_TIME" // hours without a rain tip that end a rain event, optional
+	envCalibration      = "CALIBRATION"         // JSON object of sensor -> field -> calibration, optional
+	envPublishRaw       = "PUBLISH_RAW"         // publish the uncalibrated value of calibrated fields too, optional
+	envFilterLimits     = "FILTER_LIMITS"       // JSON object of field -> limit, overriding the built in limits, optional
+	envFilterWindow     = "FILTER_WINDOW"       // minutes of history that rates of change are checked against, optional
+	envFlatlineTime     = "FLATLINE_TIME"       // hours without change before a field is flagged as flatlined, optional
+	envStuckTime        = "STUCK_TIME"          // minutes without change at a suspicious level before a field is flagged as stuck, optional
+	envFlatlineTol      = "FLATLINE_TOLERANCE"  // JSON object of field -> change that still counts as no change, optional
+	envDayBoundary      = "DAY_BOUNDARY"        // local hour (0 - 23) that the weather day starts at, optional
+	envLatitude         = "LATITUDE"            // degrees north of the station, optional but needed for solar data
+	envLongitude        = "LONGITUDE"           // degrees east of the station, optional but needed for solar data
+	envElevation        = "ELEVATION"           // metres above sea level of the station, optional
+	envSunshineFraction = "SUNSHINE_FRACTION"   // fraction of the clear sky radiation that counts as sunshine, optional
+	envIrrigationZones  = "IRRIGATION_ZONES"    // JSON object of zone -> irrigation zone, optional
+	envGDDBase          = "GDD_BASE"            // temperature (C) growing degree days are counted from, optional
+	envGDDCap           = "GDD_CAP"             // temperature (C) growing degree days stop counting at, optional
+	envSeasonStart      = "SEASON_START"        // month and day (MM-DD) that the growing season starts on, optional
+	envAlertRules       = "ALERT_RULES"         // JSON object of rule name -> alert rule, optional
+	envAlertWebhook     = "ALERT_WEBHOOK_URL"   // URL that alerts are posted to, optional
+	envAlertSMTP        = "ALERT_SMTP_URL"      // SMTP server URL that alerts are mailed through, optional
+	envAlertSMTPFrom    = "ALERT_SMTP_FROM"     // address alerts are mailed from, needed with ALERT_SMTP_URL
+	envAlertSMTPTo      = "ALERT_SMTP_TO"       // comma separated addresses alerts are mailed to, needed with ALERT_SMTP_URL
+	envUnits            = "UNITS"               // unit system data is published in, metric or imperial, optional
+	envUnitOverrides    = "UNITS_OVERRIDE"      // JSON object of field -> unit, overriding the unit system, optional
+	envPrecision        = "PRECISION"           // JSON object of field -> decimals published, optional
+	envPayloadFormat    = "PAYLOAD_FORMAT"      // shape of the published data, flat or envelope, optional
+	envSensorAliases    = "SENSOR_ALIASES"      // JSON object of sensor -> alias, optional
+	envReceiver         = "RECEIVER"            // name of the receiver the sensors are heard by, optional
+	envFieldTopics      = "FIELD_TOPICS"        // publish each field to its own topic, off, also or only, optional
+	envFieldRetain      = "FIELD_RETAIN"        // JSON object of field -> retain for field topics, optional
+	envFieldRefresh     = "FIELD_REFRESH"       // minutes after which unchanged fields are published again, optional
+	envBaseTopic        = "BASE_TOPIC"          // topic everything is published under, optional
+	envSite             = "SITE"                // name of the site for topic templates, optional
+	envTopicTemplate    = "TOPIC_TEMPLATE"      // topic sensor data is published to, e.g. {base}/{model}/{channel}/{id}, optional
+	envTopicReplace     = "TOPIC_REPLACE"       // JSON object of string -> replacement made in the sensor's values in topics, optional
+	envTopicNumbers     = "TOPIC_PLAIN_NUMBERS" // write the sensor's numbers in topics as they were sent, not with six decimals, optional
+	envHADiscovery      = "HA_DISCOVERY"        // publish Home Assistant discovery config, optional
+	envHAPrefix         = "HA_DISCOVERY_PREFIX" // topic Home Assistant looks for discovery config under, optional
+	envHAOfflineTime    = "HA_OFFLINE_TIME"     // minutes without data before a sensor is unavailable in Home Assistant, optional
+	envHARemoveTime     = "HA_REMOVE_TIME"      // hours without data before a sensor is removed from Home Assistant, optional
+	envHomie            = "HOMIE"               // publish the bridge as a Homie device, optional
+	envHomiePrefix      = "HOMIE_PREFIX"        // topic Homie devices are published under, optional
+	envHomieDeviceID    = "HOMIE_DEVICE_ID"     // id the bridge is published as, optional
+	envDeadband         = "DEADBAND"            // JSON object of field -> deadband, publish only when a field changes by more, optional
+	envHeartbeat        = "HEARTBEAT"           // minutes after which unchanged data is published again with DEADBAND, optional
+
+	envTemplates     = "PAYLOAD_TEMPLATES"      // JSON object of name -> payload template, optional
+	envTemplatesOnly = "PAYLOAD_TEMPLATES_ONLY" // publish the payload templates in place of the sensor's data, optional
+	envEncoding      = "ENCODING"               // encoding of the published data, json, cbor, msgpack or protobuf, optional
+)
+
+// Defaults for the optional configuration
+const (
+	defaultRainEventDryTime = 6  // hours
+	defaultFilterWindow     = 10 // minutes
+	defaultFlatlineTime     = 6  // hours
+	defaultStuckTime        = 60 // minutes
+	defaultDayBoundary      = 0  // midnight
+	defaultElevation        = 0  // metres
+	defaultSunshineFraction = 0.7
+	defaultCropCoefficient  = 1
+	defaultZoneDepletion    = 0.5
+	defaultGDDBase          = 10 // C
+	defaultGDDCap           = 30 // C
+	defaultSeasonStart      = "01-01"
+	defaultUnits            = units.Metric
+	defaultPayloadFormat    = payload.Flat
+	defaultFieldTopics      = payload.FieldTopicsOff
+	defaultFieldRefresh     = 15 // minutes
+	defaultBaseTopic        = topic.DefaultBase
+	defaultTopicTemplate    = topic.DefaultTemplate
+	defaultHAPrefix         = homeassistant.DefaultPrefix
+	defaultHAOfflineTime    = 15 // minutes
+	defaultHARemoveTime     = 24 // hours
+	defaultHomiePrefix      = homie.DefaultPrefix
+	defaultHomieDeviceID    = homie.DefaultDeviceID
+	defaultHeartbeat        = 15 // minutes
+	defaultEncoding         = encoder.JSON
 )
 
 // Config holds the configuration
@@ -28,6 +116,138 @@ type Config struct {
 	ServerURL         *url.URL      // MQTT server URL
 	KeepAlive         uint16        // seconds between keepalive packets
 	ConnectRetryDelay time.Duration // Period between connection attempts
+
+	// Weather data details
+	RainEventDryTime time.Duration                     // Dry period that ends a rain event, the next tip after it starts a new one
+	Calibration      map[string]map[string]Calibration // Sensor -> field -> calibration, "*" matches any sensor
+	PublishRaw       bool                              // Publish uncalibrated values as <field>_raw
+	FilterLimits     map[string]Limit                  // Field -> limits, merged over the built in limits
+	FilterWindow     time.Duration                     // History that rates of change are checked against
+	FlatlineTime     time.Duration                     // Time without change before a field is flatlined
+	StuckTime        time.Duration                     // Time without change at a suspicious level before a field is stuck
+	FlatlineTol      map[string]float64                // Field -> change that still counts as no change
+	Location         *time.Location                    // Where local days are measured, from TZ
+	DayBoundary      time.Duration                     // Time after local midnight that the weather day starts
+	Position         *Position                         // Where the station is, nil if it wasn't configured
+	SunshineFraction float64                           // Fraction of the clear sky radiation that counts as sunshine
+	IrrigationZones  map[string]Zone                   // Zone -> irrigation zone
+	GDDBase          float64                           // Temperature growing degree days are counted from
+	GDDCap           float64                           // Temperature growing degree days stop counting at
+	SeasonMonth      time.Month                        // Month the season starts in
+	SeasonDay        int                               // Day of the month the season starts on
+
+	// Publishing details
+	Units         string            // Unit system data is published in
+	UnitOverrides map[string]string // Field -> unit, overriding the unit system
+	Precision     map[string]uint   // Field -> decimals published, overriding the default for its unit
+	PayloadFormat string            // Shape of the published data
+	Encoding      string            // Encoding of the published data
+	SensorAliases map[string]string // Sensor -> alias
+	Receiver      string            // Receiver the sensors are heard by, the host name unless it is set
+	FieldTopics   string            // Whether each field is published to its own topic
+	FieldRetain   map[string]bool   // Field -> retain on its own topic, "*" matches any field
+	FieldRefresh  time.Duration     // Time after which unchanged fields are published again
+	BaseTopic     string            // Topic everything is published under
+	Site          string            // Name of the site for topic templates
+	TopicTemplate string            // Topic sensor data is published to
+	TopicReplace  map[string]string // String -> replacement made in the sensor's values in topics
+	TopicNumbers  bool              // Write the sensor's numbers in topics as they were sent
+
+	// Payload template details
+	Templates     map[string]PayloadTemplate // Name -> payload template
+	TemplatesOnly bool                       // Publish the templates in place of the sensor's data
+
+	// Report by exception details
+	Deadbands map[string]Deadband // Field -> deadband, "*" matches any field, every reading is published without any
+	Heartbeat time.Duration       // Time after which unchanged data is published again
+
+	// Home Assistant details
+	HADiscovery   bool          // Publish discovery config
+	HAPrefix      string        // Topic discovery config is published under
+	HAOfflineTime time.Duration // Time without data before a sensor is unavailable
+	HARemoveTime  time.Duration // Time without data before a sensor is removed
+
+	// Homie details
+	Homie         bool   // Publish the bridge as a Homie device
+	HomiePrefix   string // Topic Homie devices are published under
+	HomieDeviceID string // Id the bridge is published as
+
+	// Alerting details
+	AlertRules   map[string]AlertRule // Rule name -> alert rule
+	AlertWebhook *url.URL             // URL alerts are posted to, nil if there isn't one
+	AlertSMTP    *SMTP                // Server alerts are mailed through, nil if there isn't one
+}
+
+// AlertRule raises an alert when a field goes above or below a threshold, or
+// when a sensor hasn't been heard from for Offline minutes
+type AlertRule struct {
+	Sensor     string   `json:"sensor"`     // sensor the rule applies to, missing or "*" applies to every sensor
+	Field      string   `json:"field"`      // field that is checked
+	Above      *float64 `json:"above"`      // raised when the field is above this
+	Below      *float64 `json:"below"`      // raised when the field is below this
+	Hysteresis float64  `json:"hysteresis"` // how far back past the threshold the field has to go to clear
+	Duration   int      `json:"duration"`   // minutes the field has to stay past the threshold to raise
+	Cooldown   int      `json:"cooldown"`   // minutes after being raised before the rule can be raised again
+	Offline    int      `json:"offline"`    // minutes without data from the sensor, in place of a field
+}
+
+// SMTP is the mail server alerts are sent through
+type SMTP struct {
+	URL  *url.URL // smtp://[user:password@]host:port
+	From string
+	To   []string
+}
+
+// Position is where the station is
+type Position struct {
+	Latitude  float64 // degrees, north is positive
+	Longitude float64 // degrees, east is positive
+	Elevation float64 // metres above sea level
+}
+
+// Zone is an irrigation zone, watered once its root zone has been depleted by
+// Depletion of its Capacity
+type Zone struct {
+	Sensor    string  `json:"sensor"`    // sensor the zone follows, missing or "*" follows every sensor
+	Kc        float64 `json:"kc"`        // crop coefficient, 0 or missing is treated as 1
+	Capacity  float64 `json:"capacity"`  // mm of water the root zone holds
+	Depletion float64 `json:"depletion"` // fraction of capacity, 0 or missing is treated as 0.5
+}
+
+// Calibration corrects the value of a single field as value * Multiplier +
+// Offset, and then for angles adds Rotation and wraps the result into 0 - 359
+type Calibration struct {
+	Offset     float64 `json:"offset"`
+	Multiplier float64 `json:"multiplier"` // 0 or missing is treated as 1
+	Rotation   float64 `json:"rotation"`   // degrees
+}
+
+// Limit is the range of believable values for a field, and how fast it can
+// believably change. Missing members are not checked.
+type Limit struct {
+	Min     *float64 `json:"min"`
+	Max     *float64 `json:"max"`
+	Rate    *float64 `json:"rate"`    // per minute
+	Counter *bool    `json:"counter"` // only falls when it is reset, so the rate only limits its rises
+}
+
+// PayloadTemplate is a Go text/template rendered against each packet of a
+// sensor's data, in the units it is published in, and published to Topic. The
+// topic can use the same variables as the topic template.
+type PayloadTemplate struct {
+	Sensor   string `json:"sensor"`   // sensor the template applies to, missing or "*" applies to every sensor
+	Topic    string `json:"topic"`    // topic the payload is published to, e.g. {base}/{alias|model}/sign
+	Template string `json:"template"` // e.g. {{round .temp 0}}C {{.hum}}%
+	Retain   bool   `json:"retain"`
+}
+
+// Deadband is how far a field can move from the value last published before it
+// has changed, either an absolute amount in the units it is published in or a
+// percentage of the value. A field without one has changed when it is at all
+// different.
+type Deadband struct {
+	Absolute float64 `json:"absolute"`
+	Percent  float64 `json:"percent"`
 }
 
 // GetConfig - Retrieves the configuration from the environment
@@ -61,9 +281,450 @@ func GetConfig() (Config, error) {
 		return Config{}, err
 	}
 
+	if cfg.RainEventDryTime, err = hoursFromEnvDefault(envRainEventDryTime, defaultRainEventDryTime); err != nil {
+		return Config{}, err
+	}
+
+	if err = jsonFromEnv(envCalibration, &cfg.Calibration); err != nil {
+		return Config{}, err
+	}
+	for _, fields := range cfg.Calibration {
+		for field, cal := range fields {
+			if cal.Multiplier == 0 {
+				cal.Multiplier = 1
+				fields[field] = cal
+			}
+		}
+	}
+
+	if cfg.PublishRaw, err = boolFromEnvDefault(envPublishRaw, false); err != nil {
+		return Config{}, err
+	}
+
+	if err = jsonFromEnv(envFilterLimits, &cfg.FilterLimits); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.FilterWindow, err = minutesFromEnvDefault(envFilterWindow, defaultFilterWindow); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.FlatlineTime, err = hoursFromEnvDefault(envFlatlineTime, defaultFlatlineTime); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.StuckTime, err = minutesFromEnvDefault(envStuckTime, defaultStuckTime); err != nil {
+		return Config{}, err
+	}
+
+	if err = jsonFromEnv(envFlatlineTol, &cfg.FlatlineTol); err != nil {
+		return Config{}, err
+	}
+
+	cfg.Location = time.Local
+
+	var dayBoundary int
+	if dayBoundary, err = intFromEnvDefault(envDayBoundary, defaultDayBoundary); err != nil {
+		return Config{}, err
+	}
+	if (dayBoundary < 0) || (dayBoundary > 23) {
+		return Config{}, fmt.Errorf("environmental variable %s must be an hour from 0 to 23", envDayBoundary)
+	}
+	cfg.DayBoundary = time.Duration(dayBoundary) * time.Hour
+
+	if cfg.Position, err = positionFromEnv(); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.SunshineFraction, err = floatFromEnvDefault(envSunshineFraction, defaultSunshineFraction); err != nil {
+		return Config{}, err
+	}
+	if (cfg.SunshineFraction <= 0) || (cfg.SunshineFraction > 1) {
+		return Config{}, fmt.Errorf("environmental variable %s must be greater than 0 and at most 1", envSunshineFraction)
+	}
+
+	if err = jsonFromEnv(envIrrigationZones, &cfg.IrrigationZones); err != nil {
+		return Config{}, err
+	}
+	for name, zone := range cfg.IrrigationZones {
+		/* Each zone is published to a topic level of its own */
+		if len(name) == 0 {
+			return Config{}, fmt.Errorf("environmental variable %s zones must have a name", envIrrigationZones)
+		}
+		if err := topic.CheckLevel(name); err != nil {
+			return Config{}, fmt.Errorf("environmental variable %s zone %s %v", envIrrigationZones, name, err)
+		}
+		if zone.Kc == 0 {
+			zone.Kc = defaultCropCoefficient
+		}
+		if zone.Depletion == 0 {
+			zone.Depletion = defaultZoneDepletion
+		}
+		if zone.Sensor == "" {
+			zone.Sensor = "*"
+		}
+		if (zone.Kc < 0) || (zone.Capacity <= 0) || (zone.Depletion < 0) || (zone.Depletion > 1) {
+			return Config{}, fmt.Errorf("environmental variable %s zone %s must have a positive capacity, kc and depletion from 0 to 1", envIrrigationZones, name)
+		}
+		cfg.IrrigationZones[name] = zone
+	}
+
+	if cfg.GDDBase, err = floatFromEnvDefault(envGDDBase, defaultGDDBase); err != nil {
+		return Config{}, err
+	}
+	if cfg.GDDCap, err = floatFromEnvDefault(envGDDCap, defaultGDDCap); err != nil {
+		return Config{}, err
+	}
+	if cfg.GDDCap <= cfg.GDDBase {
+		return Config{}, fmt.Errorf("environmental variable %s must be above %s", envGDDCap, envGDDBase)
+	}
+
+	seasonStart := os.Getenv(envSeasonStart)
+	if len(seasonStart) == 0 {
+		seasonStart = defaultSeasonStart
+	}
+	start, err := time.Parse("01-02", seasonStart)
+	if err != nil {
+		return Config{}, fmt.Errorf("environmental variable %s must be a month and day as MM-DD", envSeasonStart)
+	}
+	cfg.SeasonMonth, cfg.SeasonDay = start.Month(), start.Day()
+
+	cfg.Units = os.Getenv(envUnits)
+	if len(cfg.Units) == 0 {
+		cfg.Units = defaultUnits
+	}
+	if (cfg.Units != units.Metric) && (cfg.Units != units.Imperial) {
+		return Config{}, fmt.Errorf("environmental variable %s must be %s or %s", envUnits, units.Metric, units.Imperial)
+	}
+
+	if err = jsonFromEnv(envUnitOverrides, &cfg.UnitOverrides); err != nil {
+		return Config{}, err
+	}
+	if err = units.CheckOverrides(cfg.UnitOverrides); err != nil {
+		return Config{}, fmt.Errorf("environmental variable %s %v", envUnitOverrides, err)
+	}
+
+	if err = jsonFromEnv(envPrecision, &cfg.Precision); err != nil {
+		return Config{}, err
+	}
+	if err = units.CheckPrecision(cfg.Precision); err != nil {
+		return Config{}, fmt.Errorf("environmental variable %s %v", envPrecision, err)
+	}
+
+	cfg.PayloadFormat = os.Getenv(envPayloadFormat)
+	if len(cfg.PayloadFormat) == 0 {
+		cfg.PayloadFormat = defaultPayloadFormat
+	}
+	if (cfg.PayloadFormat != payload.Flat) && (cfg.PayloadFormat != payload.Envelope) {
+		return Config{}, fmt.Errorf("environmental variable %s must be %s or %s", envPayloadFormat, payload.Flat, payload.Envelope)
+	}
+
+	cfg.Encoding = os.Getenv(envEncoding)
+	if len(cfg.Encoding) == 0 {
+		cfg.Encoding = defaultEncoding
+	}
+	if _, err = encoder.New(cfg.Encoding); err != nil {
+		return Config{}, fmt.Errorf("environmental variable %s %v", envEncoding, err)
+	}
+
+	if err = jsonFromEnv(envSensorAliases, &cfg.SensorAliases); err != nil {
+		return Config{}, err
+	}
+
+	cfg.Receiver = os.Getenv(envReceiver)
+	if len(cfg.Receiver) == 0 {
+		if cfg.Receiver, err = os.Hostname(); err != nil {
+			return Config{}, fmt.Errorf("environmental variable %s must be set when the host name isn't available (%w)", envReceiver, err)
+		}
+	}
+
+	cfg.FieldTopics = os.Getenv(envFieldTopics)
+	if len(cfg.FieldTopics) == 0 {
+		cfg.FieldTopics = defaultFieldTopics
+	}
+	switch cfg.FieldTopics {
+	case payload.FieldTopicsOff, payload.FieldTopicsAlso, payload.FieldTopicsOnly:
+	default:
+		return Config{}, fmt.Errorf("environmental variable %s must be %s, %s or %s", envFieldTopics, payload.FieldTopicsOff, payload.FieldTopicsAlso, payload.FieldTopicsOnly)
+	}
+
+	cfg.FieldRetain = map[string]bool{"*": true}
+	if err = jsonFromEnv(envFieldRetain, &cfg.FieldRetain); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.FieldRefresh, err = minutesFromEnvDefault(envFieldRefresh, defaultFieldRefresh); err != nil {
+		return Config{}, err
+	}
+
+	cfg.BaseTopic = os.Getenv(envBaseTopic)
+	if len(cfg.BaseTopic) == 0 {
+		cfg.BaseTopic = defaultBaseTopic
+	}
+
+	cfg.Site = os.Getenv(envSite)
+
+	cfg.TopicTemplate = os.Getenv(envTopicTemplate)
+	if len(cfg.TopicTemplate) == 0 {
+		cfg.TopicTemplate = defaultTopicTemplate
+	}
+
+	if err = jsonFromEnv(envTopicReplace, &cfg.TopicReplace); err != nil {
+		return Config{}, err
+	}
+	if cfg.TopicReplace == nil {
+		cfg.TopicReplace = topic.DefaultReplacements
+	}
+
+	if cfg.TopicNumbers, err = boolFromEnvDefault(envTopicNumbers, false); err != nil {
+		return Config{}, err
+	}
+
+	if _, err = topic.New(cfg.TopicTemplate, cfg.BaseTopic, cfg.Site, cfg.TopicReplace); err != nil {
+		return Config{}, fmt.Errorf("environmental variables %s, %s, %s and %s must make a valid topic, the %v", envTopicTemplate, envBaseTopic, envSite, envTopicReplace, err)
+	}
+
+	if err = jsonFromEnv(envTemplates, &cfg.Templates); err != nil {
+		return Config{}, err
+	}
+	for name, tmpl := range cfg.Templates {
+		if tmpl.Sensor == "" {
+			tmpl.Sensor = render.AnySensor
+		}
+		if err = validateTemplate(cfg, name, tmpl); err != nil {
+			return Config{}, fmt.Errorf("environmental variable %s template %s %v", envTemplates, name, err)
+		}
+		cfg.Templates[name] = tmpl
+	}
+
+	if cfg.TemplatesOnly, err = boolFromEnvDefault(envTemplatesOnly, false); err != nil {
+		return Config{}, err
+	}
+
+	if err = jsonFromEnv(envDeadband, &cfg.Deadbands); err != nil {
+		return Config{}, err
+	}
+	for field, band := range cfg.Deadbands {
+		if err = validateDeadband(band); err != nil {
+			return Config{}, fmt.Errorf("environmental variable %s field %s %v", envDeadband, field, err)
+		}
+	}
+
+	if cfg.Heartbeat, err = minutesFromEnvDefault(envHeartbeat, defaultHeartbeat); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.HADiscovery, err = boolFromEnvDefault(envHADiscovery, false); err != nil {
+		return Config{}, err
+	}
+
+	cfg.HAPrefix = os.Getenv(envHAPrefix)
+	if len(cfg.HAPrefix) == 0 {
+		cfg.HAPrefix = defaultHAPrefix
+	}
+	if strings.ContainsAny(cfg.HAPrefix, "+#") {
+		return Config{}, fmt.Errorf("environmental variable %s must not contain the MQTT wildcards + or #", envHAPrefix)
+	}
+
+	if cfg.HAOfflineTime, err = minutesFromEnvDefault(envHAOfflineTime, defaultHAOfflineTime); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.HARemoveTime, err = hoursFromEnvDefault(envHARemoveTime, defaultHARemoveTime); err != nil {
+		return Config{}, err
+	}
+	if cfg.HARemoveTime <= cfg.HAOfflineTime {
+		return Config{}, fmt.Errorf("environmental variable %s must be longer than %s", envHARemoveTime, envHAOfflineTime)
+	}
+
+	/* Home Assistant can only read the sensor's data as JSON, field topics are
+	 * plain values whatever the encoding */
+	if cfg.HADiscovery && (cfg.Encoding != encoder.JSON) && (cfg.FieldTopics == payload.FieldTopicsOff) {
+		return Config{}, fmt.Errorf("environmental variable %s needs %s to be %s, or %s to be set", envHADiscovery, envEncoding, encoder.JSON, envFieldTopics)
+	}
+
+	if cfg.Homie, err = boolFromEnvDefault(envHomie, false); err != nil {
+		return Config{}, err
+	}
+
+	/* The broker only keeps one will for the bridge, either Home Assistant's
+	 * status or the Homie device's state */
+	if cfg.Homie && cfg.HADiscovery {
+		return Config{}, fmt.Errorf("environmental variables %s and %s can't both be set", envHomie, envHADiscovery)
+	}
+
+	cfg.HomiePrefix = os.Getenv(envHomiePrefix)
+	if len(cfg.HomiePrefix) == 0 {
+		cfg.HomiePrefix = defaultHomiePrefix
+	}
+	if strings.ContainsAny(cfg.HomiePrefix, "+#") {
+		return Config{}, fmt.Errorf("environmental variable %s must not contain the MQTT wildcards + or #", envHomiePrefix)
+	}
+
+	cfg.HomieDeviceID = os.Getenv(envHomieDeviceID)
+	if len(cfg.HomieDeviceID) == 0 {
+		cfg.HomieDeviceID = defaultHomieDeviceID
+	}
+	if err = homie.CheckID(cfg.HomieDeviceID); err != nil {
+		return Config{}, fmt.Errorf("environmental variable %s %v", envHomieDeviceID, err)
+	}
+
+	if err = jsonFromEnv(envAlertRules, &cfg.AlertRules); err != nil {
+		return Config{}, err
+	}
+	for name, rule := range cfg.AlertRules {
+		if rule.Sensor == "" {
+			rule.Sensor = "*"
+		}
+		if err = validateAlertRule(rule); err != nil {
+			return Config{}, fmt.Errorf("environmental variable %s rule %s %v", envAlertRules, name, err)
+		}
+		cfg.AlertRules[name] = rule
+	}
+
+	if cfg.AlertWebhook, err = urlFromEnvOptional(envAlertWebhook); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.AlertSMTP, err = smtpFromEnv(); err != nil {
+		return Config{}, err
+	}
+
 	return cfg, nil
 }
 
+// positionFromEnv - Retrieves the station position from the environment, latitude and longitude go together and if
+// both are blank (or non-existent) there is no position
+func positionFromEnv() (*Position, error) {
+	if (len(os.Getenv(envLatitude)) == 0) && (len(os.Getenv(envLongitude)) == 0) {
+		return nil, nil
+	}
+
+	var pos Position
+	var err error
+
+	if pos.Latitude, err = floatFromEnv(envLatitude); err != nil {
+		return nil, err
+	}
+	if (pos.Latitude < -90) || (pos.Latitude > 90) {
+		return nil, fmt.Errorf("environmental variable %s must be from -90 to 90 degrees", envLatitude)
+	}
+
+	if pos.Longitude, err = floatFromEnv(envLongitude); err != nil {
+		return nil, err
+	}
+	if (pos.Longitude < -180) || (pos.Longitude > 180) {
+		return nil, fmt.Errorf("environmental variable %s must be from -180 to 180 degrees", envLongitude)
+	}
+
+	if pos.Elevation, err = floatFromEnvDefault(envElevation, defaultElevation); err != nil {
+		return nil, err
+	}
+
+	return &pos, nil
+}
+
+// validateTemplate - Checks that a template has a valid topic and parses. That
+// it renders is checked with sample data once everything is set up.
+func validateTemplate(cfg Config, name string, tmpl PayloadTemplate) error {
+	if len(tmpl.Topic) == 0 {
+		return fmt.Errorf("must have a topic")
+	}
+
+	if _, err := topic.Parse(tmpl.Topic, cfg.BaseTopic, cfg.Site, cfg.TopicReplace); err != nil {
+		return err
+	}
+
+	if len(tmpl.Template) == 0 {
+		return fmt.Errorf("must have a template")
+	}
+
+	if _, err := render.New(name, tmpl.Template); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateDeadband - Checks that a deadband is either absolute or a percentage
+func validateDeadband(band Deadband) error {
+	if (band.Absolute < 0) || (band.Percent < 0) {
+		return fmt.Errorf("must not be negative")
+	}
+
+	if (band.Absolute > 0) && (band.Percent > 0) {
+		return fmt.Errorf("must be either absolute or a percentage")
+	}
+
+	return nil
+}
+
+// validateAlertRule - Checks that a rule is either a field with one threshold or an offline check
+func validateAlertRule(rule AlertRule) error {
+	if (rule.Hysteresis < 0) || (rule.Duration < 0) || (rule.Cooldown < 0) || (rule.Offline < 0) {
+		return fmt.Errorf("must not have negative values")
+	}
+
+	if rule.Offline > 0 {
+		if (rule.Field != "") || (rule.Above != nil) || (rule.Below != nil) {
+			return fmt.Errorf("must not have a field when it is an offline rule")
+		}
+		return nil
+	}
+
+	if rule.Field == "" {
+		return fmt.Errorf("must have a field or be an offline rule")
+	}
+
+	if (rule.Above == nil) == (rule.Below == nil) {
+		return fmt.Errorf("must have one of above or below")
+	}
+
+	return nil
+}
+
+// smtpFromEnv - Retrieves the alert mail server from the environment, if there is no server URL there is no server
+func smtpFromEnv() (*SMTP, error) {
+	var server SMTP
+	var err error
+
+	if server.URL, err = urlFromEnvOptional(envAlertSMTP); (err != nil) || (server.URL == nil) {
+		return nil, err
+	}
+	if server.URL.Port() == "" {
+		return nil, fmt.Errorf("environmental variable %s must include a port", envAlertSMTP)
+	}
+
+	if server.From, err = stringFromEnv(envAlertSMTPFrom); err != nil {
+		return nil, err
+	}
+
+	var to string
+	if to, err = stringFromEnv(envAlertSMTPTo); err != nil {
+		return nil, err
+	}
+	for _, addr := range strings.Split(to, ",") {
+		if addr = strings.TrimSpace(addr); len(addr) > 0 {
+			server.To = append(server.To, addr)
+		}
+	}
+
+	return &server, nil
+}
+
+// urlFromEnvOptional - Retrieves a URL from the environment, nil if it is blank (or non-existent)
+func urlFromEnvOptional(key string) (*url.URL, error) {
+	s := os.Getenv(key)
+	if len(s) == 0 {
+		return nil, nil
+	}
+	u, err := url.Parse(s)
+	if (err != nil) || (u.Host == "") {
+		return nil, fmt.Errorf("environmental variable %s must be a valid URL", key)
+	}
+	return u, nil
+}
+
 // stringFromEnv - Retrieves a string from the environment and ensures it is not blank (ort non-existent)
 func stringFromEnv(key string) (string, error) {
 	s := os.Getenv(key)
@@ -86,6 +747,19 @@ func intFromEnv(key string) (int, error) {
 	return i, nil
 }
 
+// floatFromEnv - Retrieves a number from the environment (must be present and valid)
+func floatFromEnv(key string) (float64, error) {
+	s := os.Getenv(key)
+	if len(s) == 0 {
+		return 0, fmt.Errorf("environmental variable %s must not be blank", key)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("environmental variable %s must be a number", key)
+	}
+	return f, nil
+}
+
 // milliSecondsFromEnv - Retrieves milliseconds (as time.Duration) from the environment (must be present and valid)
 func milliSecondsFromEnv(key string) (time.Duration, error) {
 	var i int
@@ -96,3 +770,72 @@ func milliSecondsFromEnv(key string) (time.Duration, error) {
 	}
 	return time.Duration(i) * time.Millisecond, nil
 }
+
+// intFromEnvDefault - Retrieves an integer from the environment, using the default if it is blank (or non-existent)
+func intFromEnvDefault(key string, def int) (int, error) {
+	if len(os.Getenv(key)) == 0 {
+		return def, nil
+	}
+	return intFromEnv(key)
+}
+
+// floatFromEnvDefault - Retrieves a number from the environment, using the default if it is blank (or non-existent)
+func floatFromEnvDefault(key string, def float64) (float64, error) {
+	if len(os.Getenv(key)) == 0 {
+		return def, nil
+	}
+	return floatFromEnv(key)
+}
+
+// hoursFromEnvDefault - Retrieves hours (as time.Duration) from the environment, using the default if it is blank (or non-existent)
+func hoursFromEnvDefault(key string, def int) (time.Duration, error) {
+	var i int
+	var err error
+
+	if i, err = intFromEnvDefault(key, def); err != nil {
+		return 0, err
+	}
+	if i <= 0 {
+		return 0, fmt.Errorf("environmental variable %s must be a positive number of hours", key)
+	}
+	return time.Duration(i) * time.Hour, nil
+}
+
+// minutesFromEnvDefault - Retrieves minutes (as time.Duration) from the environment, using the default if it is blank (or non-existent)
+func minutesFromEnvDefault(key string, def int) (time.Duration, error) {
+	var i int
+	var err error
+
+	if i, err = intFromEnvDefault(key, def); err != nil {
+		return 0, err
+	}
+	if i <= 0 {
+		return 0, fmt.Errorf("environmental variable %s must be a positive number of minutes", key)
+	}
+	return time.Duration(i) * time.Minute, nil
+}
+
+// boolFromEnvDefault - Retrieves a boolean from the environment, using the default if it is blank (or non-existent)
+func boolFromEnvDefault(key string, def bool) (bool, error) {
+	s := os.Getenv(key)
+	if len(s) == 0 {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("environmental variable %s must be a boolean", key)
+	}
+	return b, nil
+}
+
+// jsonFromEnv - Decodes JSON from the environment into v, leaving v untouched if it is blank (or non-existent)
+func jsonFromEnv(key string, v interface{}) error {
+	s := os.Getenv(key)
+	if len(s) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(s), v); err != nil {
+		return fmt.Errorf("environmental variable %s must be valid JSON (%w)", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package deadband
+
+import (
+	gomath "math"
+	"reflect"
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+)
+
+// AnyField is the deadband key that applies to every field, fields that are
+// listed take priority over it
+const AnyField = "*"
+
+// Reporter decides whether a sensor's data has changed enough since it was last
+// published to be published again
+type Reporter struct {
+	bands     map[string]cfg.Deadband
+	heartbeat time.Duration
+	clock     acc.Clock
+	last      map[string]interface{}
+	at        time.Time
+}
+
+func New(bands map[string]cfg.Deadband, heartbeat time.Duration, clock acc.Clock) *Reporter {
+	reporter := Reporter{
+		bands:     bands,
+		heartbeat: heartbeat,
+		clock:     clock,
+	}
+
+	return &reporter
+}
+
+// Report returns whether data should be published. It is when any field has
+// moved beyond its deadband since data was last published, a field has come or
+// gone, or nothing has been published for the heartbeat. Data that is reported
+// is what later data is compared to.
+func (r *Reporter) Report(data map[string]interface{}) bool {
+	now := r.clock.Now()
+
+	if (r.last == nil) || (now.Sub(r.at) >= r.heartbeat) || r.changed(data) {
+		r.last = data
+		r.at = now
+		return true
+	}
+
+	return false
+}
+
+func (r *Reporter) changed(data map[string]interface{}) bool {
+	if len(data) != len(r.last) {
+		return true
+	}
+
+	for field, val := range data {
+		last, ok := r.last[field]
+		if !ok {
+			return true
+		}
+
+		if r.beyond(field, last, val) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// beyond returns whether val has moved beyond the field's deadband from last.
+// Values that aren't numbers have changed when they are different.
+func (r *Reporter) beyond(field string, last interface{}, val interface{}) bool {
+	from, ok := number(last)
+	to, isNumber := number(val)
+	if !ok || !isNumber {
+		return !reflect.DeepEqual(last, val)
+	}
+
+	band, ok := r.bands[field]
+	if !ok {
+		band = r.bands[AnyField]
+	}
+
+	delta := gomath.Abs(to - from)
+
+	if band.Percent > 0 {
+		return delta > (gomath.Abs(from) * band.Percent / 100)
+	}
+
+	if band.Absolute > 0 {
+		return delta > band.Absolute
+	}
+
+	return delta != 0
+}
+
+func number(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,75 @@
+package deadband
+
+import (
+	"testing"
+	"time"
+
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func TestReport(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	bands := map[string]cfg.Deadband{
+		"temp":   {Absolute: 0.5},
+		"wspd":   {Percent: 10},
+		AnyField: {Absolute: 2},
+	}
+
+	reporter := New(bands, 15*time.Minute, clk)
+
+	var tests = []struct {
+		data   map[string]interface{}
+		report bool
+	}{
+		{map[string]interface{}{"temp": 20.0, "wspd": 5.0, "hum": 50, "batt": false}, true},
+		{map[string]interface{}{"temp": 20.5, "wspd": 5.5, "hum": 52, "batt": false}, false},
+		{map[string]interface{}{"temp": 20.6, "wspd": 5.0, "hum": 50, "batt": false}, true},
+		{map[string]interface{}{"temp": 20.6, "wspd": 5.6, "hum": 50, "batt": false}, true},
+		{map[string]interface{}{"temp": 20.6, "wspd": 5.6, "hum": 53, "batt": false}, true},
+		{map[string]interface{}{"temp": 20.6, "wspd": 5.6, "hum": 53, "batt": true}, true},
+		{map[string]interface{}{"temp": 20.6, "wspd": 5.6, "hum": 53}, true},
+		{map[string]interface{}{"temp": 20.6, "wspd": 5.6, "hum": 53, "uv": 1}, true},
+		{map[string]interface{}{"temp": 20.6, "wspd": 5.6, "hum": 53, "uv": 1}, false},
+	}
+
+	for i, test := range tests {
+		if report := reporter.Report(test.data); report != test.report {
+			t.Errorf("%d: expected %v, got %v", i, test.report, report)
+		}
+		clk.now = clk.now.Add(time.Minute)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	reporter := New(nil, 15*time.Minute, clk)
+
+	data := map[string]interface{}{"temp": 20.0, "trend": "steady"}
+
+	if !reporter.Report(data) {
+		t.Errorf("expected the first data to be reported")
+	}
+
+	for i := 1; i < 15; i++ {
+		clk.now = clk.now.Add(time.Minute)
+		if reporter.Report(data) {
+			t.Errorf("unexpected report after %d minutes", i)
+		}
+	}
+
+	clk.now = clk.now.Add(time.Minute)
+	if !reporter.Report(data) {
+		t.Errorf("expected the heartbeat to be reported")
+	}
+
+	/* Without a deadband any change is reported */
+	if !reporter.Report(map[string]interface{}{"temp": 20.01, "trend": "steady"}) {
+		t.Errorf("expected the change to be reported")
+	}
+}
@@ -0,0 +1,157 @@
+package degreedays
+
+import (
+	"math"
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Base is the temperature (C) that heating and cooling degree days are
+	// measured from
+	Base = 18.0
+
+	// ChillThreshold is the temperature (C) below which time counts towards
+	// chill hours
+	ChillThreshold = 7.2
+)
+
+// Totals are the indices over today and over the season so far, which
+// includes today
+type Totals struct {
+	GDD, GDDSeason               float64 // growing degree days
+	HDD, HDDSeason               float64 // heating degree days
+	CDD, CDDSeason               float64 // cooling degree days
+	ChillHours, ChillHoursSeason float64
+}
+
+type index struct {
+	acc    *acc.Accumulator
+	value  func(temp float64) float64 // what is integrated from the temperature
+	scale  float64                    // seconds per unit of the index
+	season float64                    // the days of the season that have ended
+}
+
+// Tracker adds up the agricultural indices over today and the season. They are
+// integrated over time rather than worked out from daily highs and lows.
+type Tracker struct {
+	gdd   *index
+	hdd   *index
+	cdd   *index
+	chill *index
+
+	dayStart    time.Time
+	seasonStart time.Time
+}
+
+// New creates a tracker with growing degree days counted from base (C) up to
+// cap (C). newDay must return a new accumulator for a day, aligned to where
+// the day starts.
+func New(base float64, cap float64, newDay func() *acc.Accumulator) *Tracker {
+	day := (24 * time.Hour).Seconds()
+
+	tracker := Tracker{
+		gdd: &index{
+			acc:   newDay(),
+			value: func(t float64) float64 { return math.Max(0, math.Min(t, cap)-base) },
+			scale: day,
+		},
+		hdd: &index{
+			acc:   newDay(),
+			value: func(t float64) float64 { return math.Max(0, Base-t) },
+			scale: day,
+		},
+		cdd: &index{
+			acc:   newDay(),
+			value: func(t float64) float64 { return math.Max(0, t-Base) },
+			scale: day,
+		},
+		chill: &index{
+			acc: newDay(),
+			value: func(t float64) float64 {
+				if t < ChillThreshold {
+					return 1
+				}
+				return 0
+			},
+			scale: time.Hour.Seconds(),
+		},
+	}
+
+	return &tracker
+}
+
+// Update adds a temperature (C) that was read during the day starting at
+// dayStart, in the season starting at seasonStart, and returns the totals
+func (t *Tracker) Update(temp float64, dayStart time.Time, seasonStart time.Time) Totals {
+	indices := []*index{t.gdd, t.hdd, t.cdd, t.chill}
+
+	/* The day that ended goes towards its season before a new one starts */
+	if !dayStart.Equal(t.dayStart) {
+		for _, i := range indices {
+			if stats, err := i.acc.Previous(); err == nil {
+				i.season += stats.Integral / i.scale
+			}
+		}
+		t.dayStart = dayStart
+	}
+
+	if !seasonStart.Equal(t.seasonStart) {
+		for _, i := range indices {
+			i.season = 0
+		}
+		t.seasonStart = seasonStart
+	}
+
+	today := make([]float64, len(indices))
+	for n, i := range indices {
+		stats, err := i.acc.Accumulate(i.value(temp))
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		today[n] = stats.Integral / i.scale
+	}
+
+	return Totals{
+		GDD:              today[0],
+		GDDSeason:        t.gdd.season + today[0],
+		HDD:              today[1],
+		HDDSeason:        t.hdd.season + today[1],
+		CDD:              today[2],
+		CDDSeason:        t.cdd.season + today[2],
+		ChillHours:       today[3],
+		ChillHoursSeason: t.chill.season + today[3],
+	}
+}
+
+// Previous returns the heating and cooling degree days of the day that has just
+// ended, acc.ErrNoData is returned if there was no temperature that day
+func (t *Tracker) Previous() (hdd float64, cdd float64, err error) {
+	hStats, err := t.hdd.acc.Previous()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	cStats, err := t.cdd.acc.Previous()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return hStats.Integral / t.hdd.scale, cStats.Integral / t.cdd.scale, nil
+}
+
+// SeasonStart returns the start of the season containing t, seasons start on
+// month/day at dayStart's time of day each year
+func SeasonStart(dayStart time.Time, month time.Month, day int) time.Time {
+	start := time.Date(dayStart.Year(), month, day, dayStart.Hour(), dayStart.Minute(), 0, 0, dayStart.Location())
+
+	if start.After(dayStart) {
+		start = start.AddDate(-1, 0, 0)
+	}
+
+	return start
+}
@@ -0,0 +1,111 @@
+package degreedays
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func approxEqual(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestTracker(t *testing.T) {
+	clk := &testClock{now: time.Date(2021, 3, 31, 0, 0, 0, 0, time.UTC)}
+	newDay := func() *acc.Accumulator {
+		return acc.New(24*time.Hour, clk, acc.CONSECUTIVE)
+	}
+
+	tracker := New(10, 30, newDay)
+	season := time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	/* 5C for 12 hours, then 35C for 6 */
+	var totals Totals
+	for i := 0; i <= 12*60; i++ {
+		totals = tracker.Update(5, clk.now.Truncate(24*time.Hour), season)
+		clk.now = clk.now.Add(time.Minute)
+	}
+	for i := 0; i < 6*60; i++ {
+		totals = tracker.Update(35, clk.now.Truncate(24*time.Hour), season)
+		clk.now = clk.now.Add(time.Minute)
+	}
+
+	/* The step from 5C to 35C takes a minute, which counts half towards each
+	 * side. Degree days are per 1440 minutes, chill hours per 60. */
+	var tests = []struct {
+		name     string
+		value    float64
+		expected float64
+	}{
+		{"gdd", totals.GDD, (20*359 + 10) / 1440.0},
+		{"chill hours", totals.ChillHours, (720 + 0.5) / 60.0},
+		{"hdd", totals.HDD, (13*720 + 6.5) / 1440.0},
+		{"cdd", totals.CDD, (17*359 + 8.5) / 1440.0},
+	}
+
+	for _, test := range tests {
+		if !approxEqual(test.value, test.expected) {
+			t.Errorf("expected %s %.4f, got %.4f", test.name, test.expected, test.value)
+		}
+	}
+
+	if !approxEqual(totals.GDDSeason, totals.GDD) || !approxEqual(totals.ChillHoursSeason, totals.ChillHours) {
+		t.Errorf("expected the season to be today, got %v", totals)
+	}
+
+	if _, _, err := tracker.Previous(); err == nil {
+		t.Errorf("unexpected degree days before a day has ended")
+	}
+
+	/* Tomorrow, and a new season, starts with nothing */
+	clk.now = time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	hdd, cdd, err := tracker.Previous()
+	if (err != nil) || !approxEqual(hdd, (13*720+6.5)/1440.0) || !approxEqual(cdd, (17*359+8.5)/1440.0) {
+		t.Errorf("expected yesterday's degree days, got %.4f, %.4f, %v", hdd, cdd, err)
+	}
+	season = time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	totals = tracker.Update(20, clk.now, season)
+	if totals.GDD != 0 || totals.GDDSeason != 0 {
+		t.Errorf("expected a new season, got %v", totals)
+	}
+
+	clk.now = clk.now.Add(time.Hour)
+	totals = tracker.Update(20, clk.now.Truncate(24*time.Hour), season)
+	if !approxEqual(totals.GDD, 10.0/24) || !approxEqual(totals.GDDSeason, 10.0/24) {
+		t.Errorf("expected an hour at 20C, got %v", totals)
+	}
+
+	/* The day after counts yesterday towards the season */
+	clk.now = clk.now.Add(24 * time.Hour)
+	totals = tracker.Update(20, clk.now.Truncate(24*time.Hour), season)
+	if totals.GDD != 0 || !approxEqual(totals.GDDSeason, 10.0/24) {
+		t.Errorf("expected yesterday in the season, got %v", totals)
+	}
+}
+
+func TestSeasonStart(t *testing.T) {
+	var tests = []struct {
+		dayStart time.Time
+		start    time.Time
+	}{
+		{time.Date(2021, 7, 23, 9, 0, 0, 0, time.UTC), time.Date(2021, 4, 1, 9, 0, 0, 0, time.UTC)},
+		{time.Date(2021, 4, 1, 9, 0, 0, 0, time.UTC), time.Date(2021, 4, 1, 9, 0, 0, 0, time.UTC)},
+		{time.Date(2021, 3, 31, 9, 0, 0, 0, time.UTC), time.Date(2020, 4, 1, 9, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		if start := SeasonStart(test.dayStart, time.April, 1); !start.Equal(test.start) {
+			t.Errorf("%v: expected %v, got %v", test.dayStart, test.start, start)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package encoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// The encodings payloads can be published in
+const (
+	JSON        = "json"
+	CBOR        = "cbor"
+	MessagePack = "msgpack"
+	Protobuf    = "protobuf"
+)
+
+// The MQTT 5 content type of each encoding
+const (
+	JSONContentType        = "application/json"
+	CBORContentType        = "application/cbor"
+	MessagePackContentType = "application/vnd.msgpack"
+	ProtobufContentType    = "application/protobuf; proto=" + PayloadMessage
+)
+
+// Encoder writes payloads in one of the encodings
+type Encoder interface {
+	Encode(v interface{}) ([]byte, error)
+	ContentType() string
+}
+
+// New returns the encoder for encoding
+func New(encoding string) (Encoder, error) {
+	switch encoding {
+	case JSON:
+		return jsonEncoder{}, nil
+
+	case CBOR:
+		/* Times are written the way they are in JSON */
+		opts := cbor.CanonicalEncOptions()
+		opts.Time = cbor.TimeRFC3339Nano
+
+		mode, err := opts.EncMode()
+		if err != nil {
+			return nil, err
+		}
+		return cborEncoder{mode: mode}, nil
+
+	case MessagePack:
+		return msgpackEncoder{}, nil
+
+	case Protobuf:
+		return protobufEncoder{}, nil
+	}
+
+	return nil, fmt.Errorf("encoding %s must be %s, %s, %s or %s", encoding, JSON, CBOR, MessagePack, Protobuf)
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonEncoder) ContentType() string { return JSONContentType }
+
+type cborEncoder struct {
+	mode cbor.EncMode
+}
+
+func (e cborEncoder) Encode(v interface{}) ([]byte, error) { return e.mode.Marshal(v) }
+
+func (cborEncoder) ContentType() string { return CBORContentType }
+
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) Encode(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+
+	enc := msgpack.NewEncoder(&b)
+	enc.SetCustomStructTag("json")
+	enc.SetSortMapKeys(true)
+	enc.UseCompactInts(true)
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func (msgpackEncoder) ContentType() string { return MessagePackContentType }
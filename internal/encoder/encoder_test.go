@@ -0,0 +1,362 @@
+package encoder
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/payload"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type testPayload struct {
+	Temp    float64                `json:"temp"`
+	Wspd    float64                `json:"wspd"`
+	Hum     int                    `json:"hum"`
+	Batt    bool                   `json:"batt"`
+	Trend   string                 `json:"trend"`
+	Empty   string                 `json:"empty,omitempty"`
+	Time    time.Time              `json:"time"`
+	Units   map[string]string      `json:"units"`
+	Records map[string]interface{} `json:"records"`
+	Ids     []string               `json:"ids"`
+	Missing *float64               `json:"missing"`
+}
+
+func testData() testPayload {
+	return testPayload{
+		Temp:    20.5,
+		Wspd:    3,
+		Hum:     54,
+		Batt:    false,
+		Trend:   "rising",
+		Time:    time.Date(2021, 7, 23, 3, 15, 46, 0, time.UTC),
+		Units:   map[string]string{"temp": "C"},
+		Records: map[string]interface{}{"today": map[string]interface{}{"temp_max": -1.5}},
+		Ids:     []string{"a", "b"},
+	}
+}
+
+/* What every encoding should decode to, numbers that are floats stay floats
+ * even without a fraction */
+var expected = map[string]interface{}{
+	"temp":    20.5,
+	"wspd":    3.0,
+	"hum":     int64(54),
+	"batt":    false,
+	"trend":   "rising",
+	"time":    "2021-07-23T03:15:46Z",
+	"units":   map[string]interface{}{"temp": "C"},
+	"records": map[string]interface{}{"today": map[string]interface{}{"temp_max": -1.5}},
+	"ids":     []interface{}{"a", "b"},
+	"missing": nil,
+}
+
+func TestNew(t *testing.T) {
+	var tests = []struct {
+		encoding    string
+		contentType string
+	}{
+		{JSON, "application/json"},
+		{CBOR, "application/cbor"},
+		{MessagePack, "application/vnd.msgpack"},
+		{Protobuf, "application/protobuf; proto=weather_sensor_bridge.v1.Payload"},
+	}
+
+	for _, test := range tests {
+		enc, err := New(test.encoding)
+		if err != nil {
+			t.Fatalf("%s: unexpected error, err: %s", test.encoding, err)
+		}
+
+		if enc.ContentType() != test.contentType {
+			t.Errorf("%s: expected %s, got %s", test.encoding, test.contentType, enc.ContentType())
+		}
+	}
+
+	if _, err := New("xml"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	enc, _ := New(JSON)
+
+	txData, err := enc.Encode(testData())
+	if err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	expectedData, _ := json.Marshal(testData())
+	if string(txData) != string(expectedData) {
+		t.Errorf("expected %s, got %s", expectedData, txData)
+	}
+}
+
+func TestCBOR(t *testing.T) {
+	enc, _ := New(CBOR)
+
+	txData, err := enc.Encode(testData())
+	if err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	mode, _ := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}{})}.DecMode()
+
+	var decoded map[string]interface{}
+	if err := mode.Unmarshal(txData, &decoded); err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	/* CBOR decodes positive integers as unsigned */
+	decoded["hum"] = int64(decoded["hum"].(uint64))
+
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("expected %v, got %v", expected, decoded)
+	}
+}
+
+func TestMessagePack(t *testing.T) {
+	enc, _ := New(MessagePack)
+
+	txData, err := enc.Encode(testData())
+	if err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := msgpack.Unmarshal(txData, &decoded); err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	/* Compact integers decode as the smallest type they fit, times are
+	 * timestamps */
+	decoded["hum"] = int64(decoded["hum"].(int8))
+	decoded["time"] = decoded["time"].(time.Time).UTC().Format(time.RFC3339)
+
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("expected %v, got %v", expected, decoded)
+	}
+
+	jsonData, _ := json.Marshal(testData())
+	if len(txData) >= len(jsonData) {
+		t.Errorf("expected msgpack to be smaller than JSON, %d >= %d", len(txData), len(jsonData))
+	}
+}
+
+func TestProtobuf(t *testing.T) {
+	enc, _ := New(Protobuf)
+
+	missing := 1.5
+
+	var tests = []struct {
+		name     string
+		data     interface{}
+		expected string
+	}{
+		{
+			"object",
+			map[string]interface{}{
+				"temp":    20.5,
+				"hum":     54,
+				"batt":    false,
+				"trend":   "rising",
+				"missing": nil,
+				"units":   map[string]string{"temp": "C"},
+				"quality": map[string]string{"wspd": "invalid"},
+				"records": map[string]interface{}{"today": map[string]interface{}{"temp_max": -1.5}},
+			},
+			`{
+				"values": {"temp": 20.5, "hum": 54},
+				"text": {"trend": "rising"},
+				"flags": {"batt": false},
+				"units": {"temp": "C"},
+				"quality": {"wspd": "invalid"},
+				"objects": {"records": {"objects": {"today": {"values": {"temp_max": -1.5}}}}}
+			}`,
+		},
+		{
+			"struct",
+			struct {
+				Rule  string    `json:"rule"`
+				Field string    `json:"field,omitempty"`
+				Value *float64  `json:"value,omitempty"`
+				Empty *float64  `json:"empty"`
+				Time  time.Time `json:"time"`
+			}{Rule: "frost", Value: &missing, Time: time.Date(2021, 7, 23, 3, 15, 46, 0, time.UTC)},
+			`{
+				"values": {"value": 1.5},
+				"text": {"rule": "frost", "time": "2021-07-23T03:15:46Z"}
+			}`,
+		},
+		{
+			"envelope",
+			testObservation(),
+			`{
+				"schema": 1,
+				"timestamp": "1627010146",
+				"sensor": {"model": "model", "id": "123"},
+				"source": "shed",
+				"values": {"temp": 20.5},
+				"text": {"temp_trend": "rising"},
+				"units": {"temp": "C", "hum": "%"},
+				"quality": {"hum": "invalid"},
+				"objects": {"records": {"objects": {"today": {
+					"values": {"temp_max": 24.2},
+					"units": {"temp_max": "C"}
+				}}}}
+			}`,
+		},
+	}
+
+	desc := payloadDescriptor(t)
+
+	for _, test := range tests {
+		txData, err := enc.Encode(test.data)
+		if err != nil {
+			t.Fatalf("%s: unexpected error, err: %s", test.name, err)
+		}
+
+		msg := dynamicpb.NewMessage(desc)
+		if err := proto.Unmarshal(txData, msg); err != nil {
+			t.Fatalf("%s: unexpected error, err: %s", test.name, err)
+		}
+
+		jsonData, _ := protojson.Marshal(msg)
+
+		var decoded, expected map[string]interface{}
+		json.Unmarshal(jsonData, &decoded)
+		json.Unmarshal([]byte(test.expected), &expected)
+
+		if !reflect.DeepEqual(decoded, expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, expected, decoded)
+		}
+	}
+
+	if _, err := enc.Encode([]string{"a"}); err == nil {
+		t.Errorf("expected an error for a payload that isn't an object")
+	}
+
+	if _, err := enc.Encode(map[string]interface{}{"ids": []string{"a"}}); err == nil {
+		t.Errorf("expected an error for a list")
+	}
+}
+
+func TestProtobufSize(t *testing.T) {
+	enc, _ := New(Protobuf)
+
+	txData, err := enc.Encode(testObservation())
+	if err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	jsonData, _ := json.Marshal(testObservation())
+	if len(txData) >= len(jsonData) {
+		t.Errorf("expected protobuf to be smaller than JSON, %d >= %d", len(txData), len(jsonData))
+	}
+}
+
+func testObservation() payload.Observation {
+	data := map[string]interface{}{
+		"temp":       20.5,
+		"temp_trend": "rising",
+		"records": map[string]interface{}{
+			"today": map[string]interface{}{"temp_max": 24.2},
+		},
+	}
+	units := map[string]string{"temp": "C", "temp_max": "C", "hum": "%"}
+
+	return payload.New(time.Date(2021, 7, 23, 3, 15, 46, 0, time.UTC), payload.Sensor{Model: "model", ID: "123"}, "shed", data, units, map[string]string{"hum": "invalid"})
+}
+
+/* payloadDescriptor is proto/weather.proto, to check payloads against */
+func payloadDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+
+	field := func(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    optional,
+			Type:     kind.Enum(),
+		}
+		if len(typeName) > 0 {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING
+	msg := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+
+	payloadMsg := &descriptorpb.DescriptorProto{
+		Name: proto.String("Payload"),
+		Field: []*descriptorpb.FieldDescriptorProto{
+			field("schema", 1, descriptorpb.FieldDescriptorProto_TYPE_UINT32, ""),
+			field("timestamp", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+			field("sensor", 3, msg, ".weather_sensor_bridge.v1.Sensor"),
+			field("source", 4, str, ""),
+		},
+	}
+
+	maps := []struct {
+		name     string
+		entry    string
+		kind     descriptorpb.FieldDescriptorProto_Type
+		typeName string
+	}{
+		{"values", "ValuesEntry", descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""},
+		{"text", "TextEntry", str, ""},
+		{"flags", "FlagsEntry", descriptorpb.FieldDescriptorProto_TYPE_BOOL, ""},
+		{"units", "UnitsEntry", str, ""},
+		{"quality", "QualityEntry", str, ""},
+		{"objects", "ObjectsEntry", msg, ".weather_sensor_bridge.v1.Payload"},
+	}
+
+	for i, m := range maps {
+		payloadMsg.NestedType = append(payloadMsg.NestedType, &descriptorpb.DescriptorProto{
+			Name: proto.String(m.entry),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("key", 1, str, ""),
+				field("value", 2, m.kind, m.typeName),
+			},
+			Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+		})
+
+		f := field(m.name, int32(5+i), msg, ".weather_sensor_bridge.v1.Payload."+m.entry)
+		f.Label = repeated
+		payloadMsg.Field = append(payloadMsg.Field, f)
+	}
+
+	sensorMsg := &descriptorpb.DescriptorProto{
+		Name: proto.String("Sensor"),
+		Field: []*descriptorpb.FieldDescriptorProto{
+			field("model", 1, str, ""),
+			field("channel", 2, str, ""),
+			field("id", 3, str, ""),
+			field("alias", 4, str, ""),
+		},
+	}
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("weather.proto"),
+		Package:     proto.String("weather_sensor_bridge.v1"),
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{payloadMsg, sensorMsg},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	return file.Messages().ByName("Payload")
+}
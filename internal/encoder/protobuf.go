@@ -0,0 +1,405 @@
+package encoder
+
+import (
+	"fmt"
+	gomath "math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/payload"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// PayloadMessage is the message payloads are, see proto/weather.proto
+const PayloadMessage = "weather_sensor_bridge.v1.Payload"
+
+// The field numbers of proto/weather.proto
+const (
+	payloadSchema    protowire.Number = 1
+	payloadTimestamp protowire.Number = 2
+	payloadSensor    protowire.Number = 3
+	payloadSource    protowire.Number = 4
+	payloadValues    protowire.Number = 5
+	payloadText      protowire.Number = 6
+	payloadFlags     protowire.Number = 7
+	payloadUnits     protowire.Number = 8
+	payloadQuality   protowire.Number = 9
+	payloadObjects   protowire.Number = 10
+
+	sensorModel   protowire.Number = 1
+	sensorChannel protowire.Number = 2
+	sensorID      protowire.Number = 3
+	sensorAlias   protowire.Number = 4
+
+	entryKey   protowire.Number = 1
+	entryValue protowire.Number = 2
+)
+
+// message is a Payload of proto/weather.proto
+type message struct {
+	schema    uint64
+	timestamp int64
+	sensor    *payload.Sensor
+	source    string
+	values    map[string]float64
+	text      map[string]string
+	flags     map[string]bool
+	units     map[string]string
+	quality   map[string]string
+	objects   map[string]*message
+}
+
+func newMessage() *message {
+	return &message{
+		values:  make(map[string]float64),
+		text:    make(map[string]string),
+		flags:   make(map[string]bool),
+		units:   make(map[string]string),
+		quality: make(map[string]string),
+		objects: make(map[string]*message),
+	}
+}
+
+type protobufEncoder struct{}
+
+// Encode writes v as a Payload. The envelope's metadata has fields of its own,
+// anything else is an object whose members are sorted by their type.
+func (protobufEncoder) Encode(v interface{}) ([]byte, error) {
+	if obs, ok := v.(payload.Observation); ok {
+		msg, err := observationMessage(obs)
+		if err != nil {
+			return nil, err
+		}
+		return msg.marshal(), nil
+	}
+
+	msg, err := objectMessage(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+
+	return msg.marshal(), nil
+}
+
+func (protobufEncoder) ContentType() string { return ProtobufContentType }
+
+// observationMessage returns the envelope as a Payload, its time is left out
+// as the timestamp is the same
+func observationMessage(obs payload.Observation) (*message, error) {
+	msg := newMessage()
+	msg.schema = uint64(obs.Schema)
+	msg.timestamp = obs.Timestamp
+	msg.sensor = &obs.Sensor
+	msg.source = obs.Source
+
+	for name, field := range obs.Fields {
+		if err := msg.addField(name, field); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(obs.Records) == 0 {
+		return msg, nil
+	}
+
+	records := newMessage()
+	for day, fields := range obs.Records {
+		dayMsg := newMessage()
+		for name, field := range fields {
+			if err := dayMsg.addField(name, field); err != nil {
+				return nil, err
+			}
+		}
+		records.objects[day] = dayMsg
+	}
+	msg.objects["records"] = records
+
+	return msg, nil
+}
+
+// addField adds the value, unit and quality of a field of the envelope, good
+// is left out
+func (msg *message) addField(name string, field payload.Field) error {
+	if err := msg.addMember(name, reflect.ValueOf(field.Value)); err != nil {
+		return err
+	}
+
+	if len(field.Unit) > 0 {
+		msg.units[name] = field.Unit
+	}
+
+	if (len(field.Quality) > 0) && (field.Quality != payload.QualityGood) {
+		msg.quality[name] = field.Quality
+	}
+
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// objectMessage returns a struct, or a map, as a Payload of its JSON members
+func objectMessage(v reflect.Value) (*message, error) {
+	for (v.Kind() == reflect.Ptr) || (v.Kind() == reflect.Interface) {
+		v = v.Elem()
+	}
+
+	msg := newMessage()
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("protobuf objects need string keys, got %s", v.Type())
+		}
+
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := msg.addMember(iter.Key().String(), iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+
+		return msg, nil
+
+	case reflect.Struct:
+		if err := msg.addStruct(v); err != nil {
+			return nil, err
+		}
+
+		return msg, nil
+	}
+
+	if !v.IsValid() {
+		return nil, fmt.Errorf("protobuf payloads must be objects, got null")
+	}
+
+	return nil, fmt.Errorf("protobuf payloads must be objects, got %s", v.Type())
+}
+
+// addStruct adds the exported fields of a struct, named and left out as their
+// json tags say
+func (msg *message) addStruct(v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+
+		name := field.Name
+		omitEmpty := false
+
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+
+			parts := strings.Split(tag, ",")
+			if len(parts[0]) > 0 {
+				name = parts[0]
+			}
+
+			for _, option := range parts[1:] {
+				omitEmpty = omitEmpty || (option == "omitempty")
+			}
+		}
+
+		if omitEmpty && empty(v.Field(i)) {
+			continue
+		}
+
+		if err := msg.addMember(name, v.Field(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addMember adds v to the map for its type, nulls are left out. The units and
+// quality of a payload's fields go in their own maps.
+func (msg *message) addMember(name string, v reflect.Value) error {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if v.Type() == timeType {
+		msg.text[name] = v.Interface().(time.Time).Format(time.RFC3339Nano)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return msg.addMember(name, v.Elem())
+
+	case reflect.Bool:
+		msg.flags[name] = v.Bool()
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		msg.values[name] = float64(v.Int())
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		msg.values[name] = float64(v.Uint())
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		msg.values[name] = v.Float()
+		return nil
+
+	case reflect.String:
+		msg.text[name] = v.String()
+		return nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+
+		if ((name == "units") || (name == "quality")) && (v.Type().Elem().Kind() == reflect.String) {
+			target := msg.units
+			if name == "quality" {
+				target = msg.quality
+			}
+
+			iter := v.MapRange()
+			for iter.Next() {
+				target[iter.Key().String()] = iter.Value().String()
+			}
+			return nil
+		}
+
+		fallthrough
+
+	case reflect.Struct:
+		object, err := objectMessage(v)
+		if err != nil {
+			return err
+		}
+		msg.objects[name] = object
+		return nil
+	}
+
+	return fmt.Errorf("protobuf can't encode %s, a %s", name, v.Type())
+}
+
+// empty returns whether JSON leaves the value of an omitempty field out
+func empty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Struct:
+		return false
+	}
+
+	return v.IsZero()
+}
+
+// marshal writes the message, map entries are in order so that the payload is
+// the same each time
+func (msg *message) marshal() []byte {
+	var b []byte
+
+	if msg.schema != 0 {
+		b = protowire.AppendTag(b, payloadSchema, protowire.VarintType)
+		b = protowire.AppendVarint(b, msg.schema)
+	}
+
+	if msg.timestamp != 0 {
+		b = protowire.AppendTag(b, payloadTimestamp, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(msg.timestamp))
+	}
+
+	if msg.sensor != nil {
+		b = protowire.AppendTag(b, payloadSensor, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalSensor(*msg.sensor))
+	}
+
+	b = appendString(b, payloadSource, msg.source)
+
+	for _, key := range sortedKeys(msg.values) {
+		var value []byte
+		value = protowire.AppendTag(value, entryValue, protowire.Fixed64Type)
+		value = protowire.AppendFixed64(value, gomath.Float64bits(msg.values[key]))
+
+		b = appendEntry(b, payloadValues, key, value)
+	}
+
+	for _, key := range sortedKeys(msg.text) {
+		b = appendEntry(b, payloadText, key, appendString(nil, entryValue, msg.text[key]))
+	}
+
+	for _, key := range sortedKeys(msg.flags) {
+		var value []byte
+		value = protowire.AppendTag(value, entryValue, protowire.VarintType)
+		value = protowire.AppendVarint(value, protowire.EncodeBool(msg.flags[key]))
+
+		b = appendEntry(b, payloadFlags, key, value)
+	}
+
+	for _, key := range sortedKeys(msg.units) {
+		b = appendEntry(b, payloadUnits, key, appendString(nil, entryValue, msg.units[key]))
+	}
+
+	for _, key := range sortedKeys(msg.quality) {
+		b = appendEntry(b, payloadQuality, key, appendString(nil, entryValue, msg.quality[key]))
+	}
+
+	for _, key := range sortedKeys(msg.objects) {
+		var value []byte
+		value = protowire.AppendTag(value, entryValue, protowire.BytesType)
+		value = protowire.AppendBytes(value, msg.objects[key].marshal())
+
+		b = appendEntry(b, payloadObjects, key, value)
+	}
+
+	return b
+}
+
+func marshalSensor(sensor payload.Sensor) []byte {
+	var b []byte
+	b = appendString(b, sensorModel, sensor.Model)
+	b = appendString(b, sensorChannel, sensor.Channel)
+	b = appendString(b, sensorID, sensor.ID)
+	b = appendString(b, sensorAlias, sensor.Alias)
+
+	return b
+}
+
+// appendString appends a string field, unless it is empty
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if len(s) == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendEntry appends an entry of the map num, value is the entry's value
+// field
+func appendEntry(b []byte, num protowire.Number, key string, value []byte) []byte {
+	var entry []byte
+	entry = protowire.AppendTag(entry, entryKey, protowire.BytesType)
+	entry = protowire.AppendString(entry, key)
+	entry = append(entry, value...)
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, entry)
+}
+
+// sortedKeys returns the keys of a map with string keys in order
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,151 @@
+package et0
+
+import (
+	"math"
+)
+
+// Method is how the reference evapotranspiration was worked out
+type Method string
+
+const (
+	PenmanMonteith Method = "penman_monteith"
+	Hargreaves     Method = "hargreaves"
+)
+
+const (
+	solarConstant  = 0.0820    // MJ/m^2/min
+	stefanBoltzDay = 4.903e-9  // MJ/K^4/m^2/day
+	stefanBoltzHr  = 2.043e-10 // MJ/K^4/m^2/h
+	albedo         = 0.23      // of the hypothetical grass reference crop
+)
+
+// Day is the weather over a day. Temperatures are required, anything else that
+// is missing means falling back to Hargreaves.
+type Day struct {
+	TempMax float64 // C
+	TempMin float64 // C
+
+	HasHum bool
+	HumMax float64 // %
+	HumMin float64 // %
+
+	HasWind bool
+	Wind    float64 // mean speed at 2m, m/s
+
+	HasRadiation bool
+	Radiation    float64 // MJ/m^2 over the day
+}
+
+// Hour is the weather over an hour
+type Hour struct {
+	Temp      float64 // mean, C
+	Hum       float64 // mean, %
+	Wind      float64 // mean speed at 2m, m/s
+	Radiation float64 // MJ/m^2 over the hour
+	ClearSky  float64 // MJ/m^2 the hour would have had under a clear sky
+	Ratio     float64 // Radiation / ClearSky to use when the sun is down
+}
+
+// SaturationVapourPressure returns the saturation vapour pressure (kPa) at
+// temperature t (C), FAO-56 eq. 11
+func SaturationVapourPressure(t float64) float64 {
+	return 0.6108 * math.Exp(17.27*t/(t+237.3))
+}
+
+// slope returns the slope of the saturation vapour pressure curve (kPa/C) at
+// temperature t (C), FAO-56 eq. 13
+func slope(t float64) float64 {
+	return 4098 * SaturationVapourPressure(t) / math.Pow(t+237.3, 2)
+}
+
+// psychrometric returns the psychrometric constant (kPa/C) at elevation (m),
+// FAO-56 eq. 7 & 8
+func psychrometric(elevation float64) float64 {
+	pressure := 101.3 * math.Pow((293-0.0065*elevation)/293, 5.26)
+
+	return 0.665e-3 * pressure
+}
+
+// ExtraterrestrialRadiation returns the radiation (MJ/m^2/day) reaching the
+// top of the atmosphere over latitude (degrees) on dayOfYear, FAO-56 eq. 21
+func ExtraterrestrialRadiation(latitude float64, dayOfYear int) float64 {
+	lat := latitude * math.Pi / 180
+	j := 2 * math.Pi * float64(dayOfYear) / 365
+
+	distance := 1 + 0.033*math.Cos(j)
+	declination := 0.409 * math.Sin(j-1.39)
+
+	/* Past the polar circles the sun either never sets or never rises */
+	cosSunset := math.Max(-1, math.Min(1, -math.Tan(lat)*math.Tan(declination)))
+	sunset := math.Acos(cosSunset)
+
+	return 24 * 60 / math.Pi * solarConstant * distance *
+		(sunset*math.Sin(lat)*math.Sin(declination) + math.Cos(lat)*math.Cos(declination)*math.Sin(sunset))
+}
+
+// Daily returns the reference evapotranspiration (mm) for a day at latitude
+// (degrees) and elevation (m), using FAO-56 Penman-Monteith (eq. 6) when there
+// is enough data and Hargreaves (eq. 52) when there isn't
+func Daily(d Day, latitude float64, elevation float64, dayOfYear int) (float64, Method) {
+	ra := ExtraterrestrialRadiation(latitude, dayOfYear)
+	tMean := (d.TempMax + d.TempMin) / 2
+
+	if !d.HasHum || !d.HasWind || !d.HasRadiation || (ra <= 0) {
+		et0 := 0.0023 * (tMean + 17.8) * math.Sqrt(math.Max(0, d.TempMax-d.TempMin)) * 0.408 * ra
+
+		return math.Max(0, et0), Hargreaves
+	}
+
+	eMax := SaturationVapourPressure(d.TempMax)
+	eMin := SaturationVapourPressure(d.TempMin)
+	es := (eMax + eMin) / 2
+	ea := (eMin*d.HumMax + eMax*d.HumMin) / 200
+
+	rso := (0.75 + 2e-5*elevation) * ra
+	ratio := math.Min(1, d.Radiation/rso)
+
+	rns := (1 - albedo) * d.Radiation
+	rnl := stefanBoltzDay * (math.Pow(d.TempMax+273.16, 4) + math.Pow(d.TempMin+273.16, 4)) / 2 *
+		(0.34 - 0.14*math.Sqrt(ea)) * (1.35*ratio - 0.35)
+	rn := rns - rnl
+
+	delta := slope(tMean)
+	gamma := psychrometric(elevation)
+
+	et0 := (0.408*delta*rn + gamma*900/(tMean+273)*d.Wind*(es-ea)) / (delta + gamma*(1+0.34*d.Wind))
+
+	return math.Max(0, et0), PenmanMonteith
+}
+
+// Hourly returns the reference evapotranspiration (mm) for an hour at
+// elevation (m) using FAO-56 Penman-Monteith (eq. 53). The sun is taken to be
+// down when there is no clear sky radiation.
+func Hourly(h Hour, elevation float64) float64 {
+	daytime := h.ClearSky > 0
+
+	ratio := h.Ratio
+	if daytime {
+		ratio = h.Radiation / h.ClearSky
+	}
+	ratio = math.Max(0, math.Min(1, ratio))
+
+	ea := SaturationVapourPressure(h.Temp) * h.Hum / 100
+
+	rns := (1 - albedo) * h.Radiation
+	rnl := stefanBoltzHr * math.Pow(h.Temp+273.16, 4) * (0.34 - 0.14*math.Sqrt(ea)) * (1.35*ratio - 0.35)
+	rn := rns - rnl
+
+	/* Soil heat flux is a larger share of the net radiation at night */
+	g := 0.1 * rn
+	if !daytime {
+		g = 0.5 * rn
+	}
+
+	delta := slope(h.Temp)
+	gamma := psychrometric(elevation)
+
+	et0 := (0.408*delta*(rn-g) + gamma*37/(h.Temp+273)*h.Wind*(SaturationVapourPressure(h.Temp)-ea)) /
+		(delta + gamma*(1+0.34*h.Wind))
+
+	return math.Max(0, et0)
+}
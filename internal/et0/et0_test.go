@@ -0,0 +1,74 @@
+package et0
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExtraterrestrialRadiation(t *testing.T) {
+	/* FAO-56 example 8, 3 September at 20S */
+	if ra := ExtraterrestrialRadiation(-20, 246); math.Abs(ra-32.2) > 0.1 {
+		t.Errorf("expected 32.2MJ/m^2, got %.2f", ra)
+	}
+
+	/* Polar night */
+	if ra := ExtraterrestrialRadiation(80, 355); ra > 0.01 {
+		t.Errorf("expected no radiation, got %.2f", ra)
+	}
+}
+
+func TestDaily(t *testing.T) {
+	/* FAO-56 example 18, Brussels on 6 July */
+	day := Day{
+		TempMax:      21.5,
+		TempMin:      12.3,
+		HasHum:       true,
+		HumMax:       84,
+		HumMin:       63,
+		HasWind:      true,
+		Wind:         2.078,
+		HasRadiation: true,
+		Radiation:    22.07,
+	}
+
+	et0, method := Daily(day, 50.8, 100, 187)
+	if method != PenmanMonteith || math.Abs(et0-3.9) > 0.05 {
+		t.Errorf("expected 3.9mm by Penman-Monteith, got %.2f by %s", et0, method)
+	}
+
+	/* Without wind it falls back to temperature alone */
+	day.HasWind = false
+
+	et0, method = Daily(day, 50.8, 100, 187)
+	expected := 0.0023 * (16.9 + 17.8) * math.Sqrt(9.2) * 0.408 * ExtraterrestrialRadiation(50.8, 187)
+	if method != Hargreaves || math.Abs(et0-expected) > 1e-9 {
+		t.Errorf("expected %.2fmm by Hargreaves, got %.2f by %s", expected, et0, method)
+	}
+}
+
+func TestHourly(t *testing.T) {
+	/* FAO-56 example 19, N'Diaye on 1 October from 14:00 to 15:00 */
+	hour := Hour{
+		Temp:      38,
+		Hum:       52,
+		Wind:      3.3,
+		Radiation: 2.450,
+		ClearSky:  2.658,
+	}
+
+	if et0 := Hourly(hour, 8); math.Abs(et0-0.63) > 0.01 {
+		t.Errorf("expected 0.63mm, got %.3f", et0)
+	}
+
+	/* and from 02:00 to 03:00 */
+	hour = Hour{
+		Temp:  28,
+		Hum:   90,
+		Wind:  1.9,
+		Ratio: 0.8,
+	}
+
+	if et0 := Hourly(hour, 8); math.Abs(et0-0.0) > 0.01 {
+		t.Errorf("expected 0.0mm, got %.3f", et0)
+	}
+}
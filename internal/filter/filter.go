@@ -0,0 +1,175 @@
+package filter
+
+import (
+	"fmt"
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+	mh "github.com/geoff-coppertop/weather-sensor-bridge/internal/maphelper"
+	log "github.com/sirupsen/logrus"
+)
+
+// Filter rejects values that are outside of the physical limits of a field, or
+// that have moved further from recent history than the field can believably
+// change in that time
+type Filter struct {
+	limits   map[string]cfg.Limit
+	window   time.Duration
+	clock    acc.Clock
+	history  map[string]*acc.Accumulator
+	accepted map[string]time.Time // when each field's newest value was accepted
+	rejected map[string]int
+}
+
+func New(limits map[string]cfg.Limit, window time.Duration, clock acc.Clock) *Filter {
+	filter := Filter{
+		limits:   limits,
+		window:   window,
+		clock:    clock,
+		history:  make(map[string]*acc.Accumulator),
+		accepted: make(map[string]time.Time),
+		rejected: make(map[string]int),
+	}
+
+	return &filter
+}
+
+// MergeLimits returns the base limits with any members set in overrides
+// replacing those of the same field
+func MergeLimits(base map[string]cfg.Limit, overrides map[string]cfg.Limit) map[string]cfg.Limit {
+	merged := make(map[string]cfg.Limit)
+
+	for field, limit := range base {
+		merged[field] = limit
+	}
+
+	for field, override := range overrides {
+		limit := merged[field]
+
+		if override.Min != nil {
+			limit.Min = override.Min
+		}
+		if override.Max != nil {
+			limit.Max = override.Max
+		}
+		if override.Rate != nil {
+			limit.Rate = override.Rate
+		}
+		if override.Counter != nil {
+			limit.Counter = override.Counter
+		}
+
+		merged[field] = limit
+	}
+
+	return merged
+}
+
+// Apply removes rejected values from data, accepted values are added to the
+// history that later values are checked against. The reason for each rejected
+// field is returned.
+func (f *Filter) Apply(data map[string]interface{}) map[string]error {
+	rejected := make(map[string]error)
+
+	for field, limit := range f.limits {
+		val, ok := mh.GetFloatValue(data, field)
+		if !ok {
+			continue
+		}
+
+		history, ok := f.history[field]
+		if !ok {
+			history = acc.New(f.window, f.clock, acc.ROLLING)
+			f.history[field] = history
+		}
+
+		if err := f.check(limit, history, f.accepted[field], val); err != nil {
+			delete(data, field)
+			f.rejected[field]++
+			rejected[field] = err
+			continue
+		}
+
+		/* The counter has been reset, its rises are checked from the new count
+		 * rather than the one before the reset */
+		if counter(limit) && fell(history, val) {
+			history = acc.New(f.window, f.clock, acc.ROLLING)
+			f.history[field] = history
+		}
+
+		if _, err := history.Accumulate(val); err != nil {
+			log.Error(err)
+		}
+
+		f.accepted[field] = f.clock.Now()
+	}
+
+	return rejected
+}
+
+func (f *Filter) check(limit cfg.Limit, history *acc.Accumulator, accepted time.Time, val float64) error {
+	if (limit.Min != nil) && (val < *limit.Min) {
+		return fmt.Errorf("%v is below the minimum of %v", val, *limit.Min)
+	}
+
+	if (limit.Max != nil) && (val > *limit.Max) {
+		return fmt.Errorf("%v is above the maximum of %v", val, *limit.Max)
+	}
+
+	if limit.Rate == nil {
+		return nil
+	}
+
+	/* Without history there is nothing to compare against, this is also how
+	 * we recover from a genuine step change since the history will age out */
+	stats, err := history.Peek()
+	if err != nil {
+		return nil
+	}
+
+	/* Since the newest value we accepted the value can't have moved further
+	 * than the rate allows from anything we've recently accepted */
+	allowed := *limit.Rate * f.clock.Now().Sub(accepted).Minutes()
+
+	/* A counter that falls has been reset, whatever it falls to */
+	if counter(limit) {
+		if val > stats.Maximum+allowed {
+			return fmt.Errorf("%v rose faster than %v per minute from %v", val, *limit.Rate, stats.Maximum)
+		}
+
+		return nil
+	}
+
+	if (val < stats.Minimum-allowed) || (val > stats.Maximum+allowed) {
+		return fmt.Errorf("%v changed faster than %v per minute from %v - %v", val, *limit.Rate, stats.Minimum, stats.Maximum)
+	}
+
+	return nil
+}
+
+func counter(limit cfg.Limit) bool {
+	return (limit.Counter != nil) && *limit.Counter
+}
+
+// fell returns whether val is below the newest value in the history, which for
+// a counter is the highest
+func fell(history *acc.Accumulator, val float64) bool {
+	stats, err := history.Peek()
+	if err != nil {
+		return false
+	}
+
+	return val < stats.Maximum
+}
+
+// Rejected returns the number of values rejected for each field so far
+func (f *Filter) Rejected() map[string]int {
+	rejected := make(map[string]int)
+
+	for field, count := range f.rejected {
+		rejected[field] = count
+	}
+
+	return rejected
+}
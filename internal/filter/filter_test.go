@@ -0,0 +1,158 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func float(f float64) *float64 {
+	return &f
+}
+
+func TestMergeLimits(t *testing.T) {
+	base := map[string]cfg.Limit{
+		"temp": {Min: float(-50), Max: float(70), Rate: float(1)},
+	}
+	overrides := map[string]cfg.Limit{
+		"temp": {Max: float(50)},
+		"hum":  {Min: float(0)},
+	}
+
+	merged := MergeLimits(base, overrides)
+
+	if temp := merged["temp"]; *temp.Min != -50 || *temp.Max != 50 || *temp.Rate != 1 {
+		t.Errorf("unexpected temp limit %v", temp)
+	}
+
+	if hum := merged["hum"]; *hum.Min != 0 || hum.Max != nil || hum.Rate != nil {
+		t.Errorf("unexpected hum limit %v", hum)
+	}
+
+	if *base["temp"].Max != 70 {
+		t.Errorf("base limits must not be modified")
+	}
+}
+
+func TestApply(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	limits := map[string]cfg.Limit{
+		"temp": {Min: float(-50), Max: float(70), Rate: float(0.5)},
+		"wdir": {Min: float(0), Max: float(359)},
+	}
+
+	filter := New(limits, 10*time.Minute, clk)
+
+	var tests = []struct {
+		input    map[string]interface{}
+		delay    time.Duration
+		rejected []string
+	}{
+		{map[string]interface{}{"temp": 20.0, "wdir": 90}, 0, []string{}},
+		{map[string]interface{}{"temp": 60.0, "wdir": 400}, time.Minute, []string{"temp", "wdir"}},
+		{map[string]interface{}{"temp": 20.8, "hum": 50}, 2 * time.Minute, []string{}},
+		{map[string]interface{}{"temp": -60.0}, time.Minute, []string{"temp"}},
+		{map[string]interface{}{"temp": 35.0}, time.Minute, []string{"temp"}},
+		{map[string]interface{}{"temp": 35.0}, 11 * time.Minute, []string{}},
+	}
+
+	for _, test := range tests {
+		clk.now = clk.now.Add(test.delay)
+
+		rejected := filter.Apply(test.input)
+
+		if len(rejected) != len(test.rejected) {
+			t.Errorf("expected %v to be rejected, got %v", test.rejected, rejected)
+		}
+
+		for _, field := range test.rejected {
+			if _, ok := rejected[field]; !ok {
+				t.Errorf("expected %s to be rejected", field)
+			}
+			if _, ok := test.input[field]; ok {
+				t.Errorf("expected %s to be removed", field)
+			}
+		}
+	}
+
+	if counts := filter.Rejected(); counts["temp"] != 3 || counts["wdir"] != 1 {
+		t.Errorf("unexpected rejection counts %v", counts)
+	}
+}
+
+func TestApplySpike(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	limits := map[string]cfg.Limit{
+		"temp": {Rate: float(1)},
+	}
+
+	filter := New(limits, 10*time.Minute, clk)
+
+	/* A steady temperature, a packet every 16 seconds */
+	for i := 0; i < 10; i++ {
+		if rejected := filter.Apply(map[string]interface{}{"temp": 20.0}); len(rejected) != 0 {
+			t.Fatalf("unexpected rejection %v", rejected)
+		}
+		clk.now = clk.now.Add(16 * time.Second)
+	}
+
+	/* A spike in a single packet is rejected, even though the window would
+	 * allow that much change */
+	if rejected := filter.Apply(map[string]interface{}{"temp": 29.0}); len(rejected) != 1 {
+		t.Errorf("expected the spike to be rejected")
+	}
+
+	/* As is a value that has moved a little too far for the time since */
+	clk.now = clk.now.Add(16 * time.Second)
+	if rejected := filter.Apply(map[string]interface{}{"temp": 20.6}); len(rejected) != 1 {
+		t.Errorf("expected 0.6 in 32 seconds to be rejected")
+	}
+
+	clk.now = clk.now.Add(16 * time.Second)
+	if rejected := filter.Apply(map[string]interface{}{"temp": 20.6}); len(rejected) != 0 {
+		t.Errorf("expected 0.6 in 48 seconds to be accepted, got %v", rejected)
+	}
+}
+
+func TestApplyCounter(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	counter := true
+	limits := map[string]cfg.Limit{
+		"rain_acc": {Min: float(0), Rate: float(10), Counter: &counter},
+	}
+
+	filter := New(limits, 10*time.Minute, clk)
+
+	var tests = []struct {
+		val      float64
+		rejected bool
+	}{
+		{250.0, false},
+		{250.5, false},
+		/* A spike in the count is rejected */
+		{900.0, true},
+		/* The count is reset, by a battery change */
+		{0.0, false},
+		/* Rises are checked from the new count */
+		{240.0, true},
+		{1.0, false},
+		{-1.0, true},
+	}
+
+	for _, test := range tests {
+		clk.now = clk.now.Add(time.Minute)
+
+		rejected := filter.Apply(map[string]interface{}{"rain_acc": test.val})
+
+		if _, ok := rejected["rain_acc"]; ok != test.rejected {
+			t.Errorf("%v: expected rejected to be %v, got %v", test.val, test.rejected, rejected)
+		}
+	}
+}
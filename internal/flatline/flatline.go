@@ -0,0 +1,147 @@
+package flatline
+
+import (
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+	mh "github.com/geoff-coppertop/weather-sensor-bridge/internal/maphelper"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	FlagFlatline = "flatline" // no change beyond the tolerance for the flatline time
+	FlagStuck    = "stuck"    // no change at a suspicious level for the stuck time
+)
+
+// Range is an inclusive range of values
+type Range struct {
+	Min float64
+	Max float64
+}
+
+func (r Range) contains(val float64) bool {
+	return (val >= r.Min) && (val <= r.Max)
+}
+
+// Rule describes how a field is checked. Levels are values, such as the ends
+// of the sensor's range next to its error values, where a sensor tends to get
+// stuck so they are flagged sooner.
+type Rule struct {
+	Tolerance float64
+	Levels    []Range
+}
+
+type field struct {
+	flatline *acc.Accumulator
+	stuck    *acc.Accumulator
+	flag     string
+}
+
+// Detector flags fields whose values have stopped changing
+type Detector struct {
+	rules        map[string]Rule
+	flatlineTime time.Duration
+	stuckTime    time.Duration
+	clock        acc.Clock
+	fields       map[string]*field
+}
+
+func New(rules map[string]Rule, flatlineTime time.Duration, stuckTime time.Duration, clock acc.Clock) *Detector {
+	detector := Detector{
+		rules:        rules,
+		flatlineTime: flatlineTime,
+		stuckTime:    stuckTime,
+		clock:        clock,
+		fields:       make(map[string]*field),
+	}
+
+	return &detector
+}
+
+// Update checks the fields in data and returns true if any flag was raised or
+// cleared
+func (d *Detector) Update(data map[string]interface{}) bool {
+	changed := false
+
+	for name, rule := range d.rules {
+		val, ok := mh.GetFloatValue(data, name)
+		if !ok {
+			continue
+		}
+
+		f, ok := d.fields[name]
+		if !ok {
+			f = &field{
+				flatline: acc.New(d.flatlineTime, d.clock, acc.ROLLING),
+				stuck:    acc.New(d.stuckTime, d.clock, acc.ROLLING),
+			}
+			d.fields[name] = f
+		}
+
+		flag, err := d.check(rule, f, val)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		if flag != f.flag {
+			if flag != "" {
+				log.Warnf("%s is %s at %v", name, flag, val)
+			} else {
+				log.Infof("%s is no longer %s", name, f.flag)
+			}
+
+			f.flag = flag
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+func (d *Detector) check(rule Rule, f *field, val float64) (string, error) {
+	flatStats, err := f.flatline.Accumulate(val)
+	if err != nil {
+		return "", err
+	}
+
+	stuckStats, err := f.stuck.Accumulate(val)
+	if err != nil {
+		return "", err
+	}
+
+	if isFlat(flatStats, d.flatlineTime, rule.Tolerance) {
+		return FlagFlatline, nil
+	}
+
+	if isFlat(stuckStats, d.stuckTime, rule.Tolerance) {
+		for _, level := range rule.Levels {
+			if level.contains(stuckStats.Minimum) && level.contains(stuckStats.Maximum) {
+				return FlagStuck, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+/* The window has to be (nearly) full, otherwise we'd flag everything right
+ * after starting up */
+func isFlat(stats acc.Stats, window time.Duration, tolerance float64) bool {
+	covered := stats.Span >= window-(window/10)
+
+	return covered && (stats.Maximum-stats.Minimum <= tolerance)
+}
+
+// Flags returns the current flag of each flagged field
+func (d *Detector) Flags() map[string]string {
+	flags := make(map[string]string)
+
+	for name, f := range d.fields {
+		if f.flag != "" {
+			flags[name] = f.flag
+		}
+	}
+
+	return flags
+}
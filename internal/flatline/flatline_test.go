@@ -0,0 +1,75 @@
+package flatline
+
+import (
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func TestFlatline(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	rules := map[string]Rule{
+		"temp": {Tolerance: 0.1},
+	}
+
+	detector := New(rules, time.Hour, 10*time.Minute, clk)
+
+	/* A steady value isn't flagged until it has been steady for the window */
+	for i := 0; i <= 50; i++ {
+		if detector.Update(map[string]interface{}{"temp": 20.0}) {
+			t.Errorf("unexpected change after %d minutes", i)
+		}
+		clk.now = clk.now.Add(time.Minute)
+	}
+
+	for i := 0; i < 10; i++ {
+		detector.Update(map[string]interface{}{"temp": 20.05})
+		clk.now = clk.now.Add(time.Minute)
+	}
+
+	if flags := detector.Flags(); flags["temp"] != FlagFlatline {
+		t.Errorf("expected temp to be flatlined, got %v", flags)
+	}
+
+	if !detector.Update(map[string]interface{}{"temp": 21.0}) {
+		t.Errorf("expected the flag to clear")
+	}
+
+	if flags := detector.Flags(); len(flags) != 0 {
+		t.Errorf("expected no flags, got %v", flags)
+	}
+}
+
+func TestStuck(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	rules := map[string]Rule{
+		"hum": {Tolerance: 1, Levels: []Range{{Min: 99, Max: 100}}},
+	}
+
+	detector := New(rules, 6*time.Hour, 10*time.Minute, clk)
+
+	/* Steady, but not at a suspicious level */
+	for i := 0; i <= 20; i++ {
+		detector.Update(map[string]interface{}{"hum": 50})
+		clk.now = clk.now.Add(time.Minute)
+	}
+
+	if flags := detector.Flags(); len(flags) != 0 {
+		t.Errorf("expected no flags, got %v", flags)
+	}
+
+	changed := false
+	for i := 0; i <= 20; i++ {
+		changed = detector.Update(map[string]interface{}{"hum": 99 + i%2}) || changed
+		clk.now = clk.now.Add(time.Minute)
+	}
+
+	if flags := detector.Flags(); !changed || flags["hum"] != FlagStuck {
+		t.Errorf("expected hum to be stuck, got %v", flags)
+	}
+}
@@ -0,0 +1,177 @@
+package homeassistant
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultPrefix is the topic Home Assistant looks for discovery config under
+	DefaultPrefix = "homeassistant"
+
+	// Online and Offline are published to availability topics
+	Online  = "online"
+	Offline = "offline"
+
+	// The states of binary sensors
+	On  = "true"
+	Off = "false"
+
+	Sensor       = "sensor"
+	BinarySensor = "binary_sensor"
+
+	Measurement     = "measurement"
+	TotalIncreasing = "total_increasing"
+)
+
+// Device groups the entities of a physical sensor
+type Device struct {
+	Identifiers []string `json:"identifiers"`
+	Name        string   `json:"name"`
+	Model       string   `json:"model,omitempty"`
+}
+
+// Availability is a topic that says whether an entity is available
+type Availability struct {
+	Topic string `json:"topic"`
+}
+
+// Config is the discovery config of a single entity
+type Config struct {
+	Name             string         `json:"name"`
+	UniqueID         string         `json:"unique_id"`
+	StateTopic       string         `json:"state_topic"`
+	ValueTemplate    string         `json:"value_template,omitempty"`
+	DeviceClass      string         `json:"device_class,omitempty"`
+	StateClass       string         `json:"state_class,omitempty"`
+	Unit             string         `json:"unit_of_measurement,omitempty"`
+	PayloadOn        string         `json:"payload_on,omitempty"`
+	PayloadOff       string         `json:"payload_off,omitempty"`
+	Availability     []Availability `json:"availability"`
+	AvailabilityMode string         `json:"availability_mode"`
+	Device           Device         `json:"device"`
+}
+
+// The device class of each field, fields that aren't here don't have one
+var deviceClasses = map[string]string{
+	"temp":            "temperature",
+	"dewpoint":        "temperature",
+	"feels_like":      "temperature",
+	"heat_index":      "temperature",
+	"apparent_temp":   "temperature",
+	"wetbulb":         "temperature",
+	"wind_chill":      "temperature",
+	"hum":             "humidity",
+	"wspd":            "wind_speed",
+	"wspd_2m":         "wind_speed",
+	"wspd_gust":       "wind_speed",
+	"wspd_gust_10m":   "wind_speed",
+	"wspd_gust_24hr":  "wind_speed",
+	"rain_acc":        "precipitation",
+	"rain_1hr":        "precipitation",
+	"rain_24hr":       "precipitation",
+	"rain_event_acc":  "precipitation",
+	"rain_rate":       "precipitation_intensity",
+	"solar":           "irradiance",
+	"solar_clear_sky": "irradiance",
+	"light":           "illuminance",
+	"vapour_pressure": "pressure",
+	"rain_event_dur":  "duration",
+	"sunshine_24hr":   "duration",
+
+	/* Binary sensors */
+	"batt":       "battery",
+	"rain_event": "moisture",
+	"sunshine":   "light",
+}
+
+/* Fields that only go up until they start again from nothing, a new day or a
+ * new rain event */
+var totals = map[string]bool{
+	"rain_acc":           true,
+	"rain_24hr":          true,
+	"rain_event_acc":     true,
+	"et0_today":          true,
+	"insolation_24hr":    true,
+	"sunshine_24hr":      true,
+	"wind_run_24hr":      true,
+	"gdd_today":          true,
+	"hdd_today":          true,
+	"cdd_today":          true,
+	"chill_hours_today":  true,
+	"gdd_season":         true,
+	"hdd_season":         true,
+	"cdd_season":         true,
+	"chill_hours_season": true,
+}
+
+// The way Home Assistant writes our units
+var units = map[string]string{
+	"C":       "°C",
+	"F":       "°F",
+	"K":       "K",
+	"C/h":     "°C/h",
+	"F/h":     "°F/h",
+	"deg":     "°",
+	"lux":     "lx",
+	"W/m^2":   "W/m²",
+	"kWh/m^2": "kWh/m²",
+	"g/m^3":   "g/m³",
+	"kn":      "kn",
+}
+
+var invalidID = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// NodeID returns the sensor key as an id that can be used in discovery topics
+func NodeID(key string) string {
+	return invalidID.ReplaceAllString(key, "_")
+}
+
+// Component returns the kind of entity a field with value is
+func Component(value interface{}) string {
+	if _, ok := value.(bool); ok {
+		return BinarySensor
+	}
+
+	return Sensor
+}
+
+// DeviceClass returns the device class of the field, uncalibrated values are
+// the same as the field
+func DeviceClass(field string) string {
+	return deviceClasses[strings.TrimSuffix(field, "_raw")]
+}
+
+// StateClass returns the state class of a field with value. Only numbers have
+// one, and directions don't as they can't be averaged.
+func StateClass(field string, value interface{}, unit string) string {
+	switch value.(type) {
+	case int, float64:
+	default:
+		return ""
+	}
+
+	if totals[field] {
+		return TotalIncreasing
+	}
+
+	if unit == "deg" {
+		return ""
+	}
+
+	return Measurement
+}
+
+// Unit returns unit as Home Assistant writes it
+func Unit(unit string) string {
+	if u, ok := units[unit]; ok {
+		return u
+	}
+
+	return unit
+}
+
+// Name returns the name of a field's entity
+func Name(field string) string {
+	return strings.ReplaceAll(field, "_", " ")
+}
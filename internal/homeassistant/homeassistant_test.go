@@ -0,0 +1,69 @@
+package homeassistant
+
+import (
+	"testing"
+)
+
+func TestNodeID(t *testing.T) {
+	if id := NodeID("SwitchDoc_Labs_FT020T_AIO/0/123"); id != "SwitchDoc_Labs_FT020T_AIO_0_123" {
+		t.Errorf("unexpected node id %s", id)
+	}
+}
+
+func TestClasses(t *testing.T) {
+	var tests = []struct {
+		field       string
+		value       interface{}
+		unit        string
+		component   string
+		deviceClass string
+		stateClass  string
+	}{
+		{"temp", 20.5, "C", Sensor, "temperature", Measurement},
+		{"temp_raw", 20.5, "C", Sensor, "temperature", Measurement},
+		{"hum", 54, "%", Sensor, "humidity", Measurement},
+		{"rain_acc", 0.3, "mm", Sensor, "precipitation", TotalIncreasing},
+		{"rain_24hr", 0.3, "mm", Sensor, "precipitation", TotalIncreasing},
+		{"rain_1hr", 0.3, "mm", Sensor, "precipitation", Measurement},
+		/* Evapotranspiration is in mm, but it isn't precipitation */
+		{"et0_today", 1.2, "mm", Sensor, "", TotalIncreasing},
+		{"wdir", 100, "deg", Sensor, "", ""},
+		{"uv", 1.0, "", Sensor, "", Measurement},
+		{"temp_trend", "rising", "", Sensor, "", ""},
+		{"batt", false, "", BinarySensor, "battery", ""},
+	}
+
+	for _, test := range tests {
+		if c := Component(test.value); c != test.component {
+			t.Errorf("%s: expected %s, got %s", test.field, test.component, c)
+		}
+
+		if c := DeviceClass(test.field); c != test.deviceClass {
+			t.Errorf("%s: expected device class %s, got %s", test.field, test.deviceClass, c)
+		}
+
+		if c := StateClass(test.field, test.value, test.unit); c != test.stateClass {
+			t.Errorf("%s: expected state class %s, got %s", test.field, test.stateClass, c)
+		}
+	}
+}
+
+func TestUnit(t *testing.T) {
+	var tests = []struct {
+		unit string
+		ha   string
+	}{
+		{"C", "°C"},
+		{"F", "°F"},
+		{"W/m^2", "W/m²"},
+		{"mm", "mm"},
+		{"mph", "mph"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if u := Unit(test.unit); u != test.ha {
+			t.Errorf("%s: expected %s, got %s", test.unit, test.ha, u)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package homie
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Version is the version of the convention that is followed
+	Version = "4.0.0"
+
+	// DefaultPrefix is the topic Homie devices are published under
+	DefaultPrefix = "homie"
+	// DefaultDeviceID is the id the bridge is published as
+	DefaultDeviceID = "weather-sensor-bridge"
+)
+
+// The states of a device
+const (
+	Init         = "init"
+	Ready        = "ready"
+	Disconnected = "disconnected"
+	Lost         = "lost"
+)
+
+// The datatypes of a property
+const (
+	Integer = "integer"
+	Float   = "float"
+	Boolean = "boolean"
+	String  = "string"
+)
+
+// The attributes of devices, nodes and properties
+const (
+	HomieAttr      = "$homie"
+	NameAttr       = "$name"
+	StateAttr      = "$state"
+	NodesAttr      = "$nodes"
+	ImplAttr       = "$implementation"
+	TypeAttr       = "$type"
+	PropertiesAttr = "$properties"
+	DatatypeAttr   = "$datatype"
+	UnitAttr       = "$unit"
+)
+
+// The way Homie writes our units, units that aren't here are used as they are
+var units = map[string]string{
+	"C":   "°C",
+	"F":   "°F",
+	"deg": "°",
+}
+
+var (
+	validID   = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	invalidID = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// CheckID returns an error if id can't be the id of a device, node or property
+func CheckID(id string) error {
+	if !validID.MatchString(id) {
+		return fmt.Errorf("%q must only contain a-z, 0-9 and -, and not start with -", id)
+	}
+
+	return nil
+}
+
+// ID returns value as an id, e.g. the field rain_acc is the property rain-acc
+func ID(value string) string {
+	return strings.Trim(invalidID.ReplaceAllString(strings.ToLower(value), "-"), "-")
+}
+
+// Datatype returns the datatype of a property with value, false if it can't be
+// a property
+func Datatype(value interface{}) (string, bool) {
+	switch value.(type) {
+	case int:
+		return Integer, true
+	case float64:
+		return Float, true
+	case bool:
+		return Boolean, true
+	case string:
+		return String, true
+	}
+
+	return "", false
+}
+
+// Unit returns unit as Homie writes it
+func Unit(unit string) string {
+	if u, ok := units[unit]; ok {
+		return u
+	}
+
+	return unit
+}
+
+// Name returns the name of a field's property
+func Name(field string) string {
+	return strings.ReplaceAll(field, "_", " ")
+}
@@ -0,0 +1,67 @@
+package homie
+
+import (
+	"testing"
+)
+
+func TestID(t *testing.T) {
+	var tests = []struct {
+		value string
+		id    string
+	}{
+		{"rain_acc", "rain-acc"},
+		{"SwitchDoc_Labs_FT020T_AIO/0/123", "switchdoc-labs-ft020t-aio-0-123"},
+		{"_temp_", "temp"},
+		{"Back Garden", "back-garden"},
+	}
+
+	for _, test := range tests {
+		id := ID(test.value)
+		if id != test.id {
+			t.Errorf("%s: expected %s, got %s", test.value, test.id, id)
+		}
+
+		if err := CheckID(id); err != nil {
+			t.Errorf("%s: unexpected error, err: %s", test.value, err)
+		}
+	}
+}
+
+func TestCheckID(t *testing.T) {
+	for _, id := range []string{"", "-bridge", "Bridge", "weather_bridge", "weather/bridge", "$bridge"} {
+		if err := CheckID(id); err == nil {
+			t.Errorf("%q: expected an error", id)
+		}
+	}
+}
+
+func TestDatatype(t *testing.T) {
+	var tests = []struct {
+		value    interface{}
+		datatype string
+		ok       bool
+	}{
+		{54, Integer, true},
+		{20.5, Float, true},
+		{false, Boolean, true},
+		{"rising", String, true},
+		{map[string]interface{}{}, "", false},
+	}
+
+	for _, test := range tests {
+		datatype, ok := Datatype(test.value)
+		if (datatype != test.datatype) || (ok != test.ok) {
+			t.Errorf("%v: expected %s %v, got %s %v", test.value, test.datatype, test.ok, datatype, ok)
+		}
+	}
+}
+
+func TestUnit(t *testing.T) {
+	if u := Unit("C"); u != "°C" {
+		t.Errorf("expected °C, got %s", u)
+	}
+
+	if u := Unit("mm"); u != "mm" {
+		t.Errorf("expected mm, got %s", u)
+	}
+}
@@ -0,0 +1,62 @@
+package irrigation
+
+import (
+	"math"
+
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+)
+
+const (
+	Water = "water"
+	Skip  = "skip"
+)
+
+// Advice is the outcome of a day of the water balance
+type Advice struct {
+	Recommendation string  // Water or Skip
+	Deficit        float64 // mm needed to bring the root zone back to capacity
+	Allowed        float64 // mm the root zone can be depleted by before watering
+	Rain           float64 // mm of rain that fell during the day
+	ETc            float64 // mm the crop used during the day
+}
+
+// Balance is the soil water balance of a zone, following the FAO-56 root zone
+// depletion. It starts with the root zone at capacity.
+type Balance struct {
+	zone      cfg.Zone
+	depletion float64 // mm below capacity
+}
+
+// New creates the water balance for a zone
+func New(zone cfg.Zone) *Balance {
+	balance := Balance{
+		zone: zone,
+	}
+
+	return &balance
+}
+
+// Update adds a day of rain and reference evapotranspiration (mm) to the
+// balance and returns what to do about it. Rain beyond what the root zone can
+// hold drains away. Water is taken to be applied when recommended, so the
+// zone is back to capacity for the next day.
+func (b *Balance) Update(rain float64, et0 float64) Advice {
+	etc := b.zone.Kc * et0
+
+	b.depletion = math.Max(0, math.Min(b.zone.Capacity, b.depletion-rain+etc))
+
+	advice := Advice{
+		Recommendation: Skip,
+		Deficit:        b.depletion,
+		Allowed:        b.zone.Depletion * b.zone.Capacity,
+		Rain:           rain,
+		ETc:            etc,
+	}
+
+	if b.depletion >= advice.Allowed {
+		advice.Recommendation = Water
+		b.depletion = 0
+	}
+
+	return advice
+}
@@ -0,0 +1,40 @@
+package irrigation
+
+import (
+	"math"
+	"testing"
+
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+)
+
+func TestBalance(t *testing.T) {
+	balance := New(cfg.Zone{Kc: 0.8, Capacity: 20, Depletion: 0.5})
+
+	var tests = []struct {
+		rain           float64
+		et0            float64
+		recommendation string
+		deficit        float64
+	}{
+		{0, 5, Skip, 4},
+		{0, 5, Skip, 8},
+		{10, 5, Skip, 2},
+		{0, 5, Skip, 6},
+		{0, 5, Water, 10},
+		/* Watered back to capacity, and the rain can't take it past that */
+		{30, 5, Skip, 0},
+		{0, 30, Water, 20},
+	}
+
+	for i, test := range tests {
+		advice := balance.Update(test.rain, test.et0)
+
+		if advice.Recommendation != test.recommendation || math.Abs(advice.Deficit-test.deficit) > 1e-9 {
+			t.Errorf("day %d: expected %s with a deficit of %v, got %s with %v", i, test.recommendation, test.deficit, advice.Recommendation, advice.Deficit)
+		}
+
+		if advice.Allowed != 10 {
+			t.Errorf("day %d: expected 10mm allowed, got %v", i, advice.Allowed)
+		}
+	}
+}
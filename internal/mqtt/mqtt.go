@@ -14,22 +14,51 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// StatusTopic is where, under the base topic, the bridge says whether it is
+// online. It is set offline by the broker when the bridge goes away.
+const StatusTopic = "status"
+
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
+// Status is a retained topic that says whether the bridge is online
+type Status struct {
+	Topic   string
+	Init    string // published on connecting in place of Online, optional
+	Online  string // status while connected
+	Lost    string // status the broker sets when the bridge goes away
+	Offline string // status when the bridge disconnects
+}
+
 type Data struct {
-	Topic string
-	Data  []byte
+	Topic       string
+	Data        []byte
+	Retain      bool   // ask the broker to keep the message for new subscribers
+	ContentType string // MQTT 5 content type of Data, optional
 }
 
 type Connection struct {
 	connectionManager *autopaho.ConnectionManager
 	ctx               context.Context
+	statuses          []Status // the first is the will, if there are any
+
+	queue     chan Data                        // what is still to be published, in order
+	connected chan *autopaho.ConnectionManager // a connection whose statuses are still to be published
 
-	mu             sync.Mutex // protects following fields
+	mu             sync.Mutex      // protects following fields
+	ready          map[string]bool // statuses with an Init that have been published Online
 	onConnectionUp atomic.Value
 	onMessage      atomic.Value // of chan Data, created lazily, closed by ...
 	onError        atomic.Value
 	onDisconnect   atomic.Value
 }
 
+// publishQueueSize is how many messages can wait to be published, enough for a
+// few sensors to be described to Home Assistant and Homie at once
+const publishQueueSize = 1024
+
 // closedchan is a reusable closed channel.
 var closedchan = make(chan struct{})
 
@@ -37,9 +66,23 @@ func init() {
 	close(closedchan)
 }
 
-func Connect(ctx context.Context, cfg cfg.Config) (*Connection, error) {
+// Connect connects to the broker, publishing the bridge's statuses as it
+// connects and disconnects. The broker only keeps one will, it sets the first
+// status Lost, the others are left as they are if the bridge goes away. There
+// is no will without any statuses.
+//
+// A status with an Init is published Init when the bridge connects, it is
+// only Online again once the bridge has published it so, and from then on
+// when the bridge reconnects.
+func Connect(ctx context.Context, cfg cfg.Config, statuses []Status) (*Connection, error) {
 	var err error = nil
-	conn := &Connection{ctx: ctx}
+	conn := &Connection{
+		ctx:       ctx,
+		statuses:  statuses,
+		queue:     make(chan Data, publishQueueSize),
+		connected: make(chan *autopaho.ConnectionManager, 1),
+		ready:     make(map[string]bool),
+	}
 
 	clientCfg := autopaho.ClientConfig{
 		BrokerUrls:        []*url.URL{cfg.ServerURL},
@@ -56,11 +99,17 @@ func Connect(ctx context.Context, cfg cfg.Config) (*Connection, error) {
 		},
 	}
 
+	if len(statuses) > 0 {
+		clientCfg.SetWillMessage(statuses[0].Topic, []byte(statuses[0].Lost), 1, true)
+	}
+
 	// Connect to the broker
 	if conn.connectionManager, err = autopaho.NewConnection(ctx, clientCfg); err != nil {
 		return nil, err
 	}
 
+	go conn.publishQueued()
+
 	return conn, err
 }
 
@@ -99,7 +148,7 @@ func (conn *Connection) OnError() <-chan error {
 	oe := conn.onError.Load()
 
 	if oe == nil {
-		oe = make(chan error)
+		oe = make(chan error, 1)
 		conn.onError.Store(oe)
 	}
 
@@ -152,56 +201,142 @@ func (conn *Connection) Subscribe(topic string) {
 	}()
 }
 
+// Publish queues data to be published. Messages are published in the order
+// they are given, things like Homie depend on it. When the broker is slow or
+// away and the queue fills up, messages are dropped.
 func (conn *Connection) Publish(data Data) {
-	// Publish will block so we run it in a goRoutine
-	go func() {
-		ctx, cancel := context.WithTimeout(conn.ctx, 100*time.Millisecond)
-		defer cancel()
+	conn.mu.Lock()
+	for _, status := range conn.statuses {
+		if (len(status.Init) > 0) && (data.Topic == status.Topic) {
+			conn.ready[status.Topic] = string(data.Data) == status.Online
+		}
+	}
+	conn.mu.Unlock()
 
-		// AwaitConnection will return immediately if connection is up; adding this call stops publication whilst
-		// connection is unavailable.
-		if err := conn.connectionManager.AwaitConnection(ctx); err != nil {
-			// Should only happen when context is cancelled
-			log.Errorf("Publish timed out waiting for the connection: %v", err)
-			conn.errorHandler(err)
+	select {
+	case conn.queue <- data:
+	default:
+		log.Errorf("publish queue is full, dropped: %s", data.Topic)
+	}
+}
+
+// publishQueued publishes what is queued one message at a time, until the
+// context is done. The statuses of a new connection go ahead of anything still
+// queued.
+func (conn *Connection) publishQueued() {
+	for {
+		select {
+		case cm := <-conn.connected:
+			conn.publishStatuses(cm)
+			continue
+		default:
 		}
 
-		ctx, cancel = context.WithTimeout(conn.ctx, 100*time.Millisecond)
-		defer cancel()
+		select {
+		case cm := <-conn.connected:
+			conn.publishStatuses(cm)
 
-		if pr, err := conn.connectionManager.Publish(ctx, &paho.Publish{
-			Topic:   data.Topic,
-			Payload: data.Data,
-		}); err != nil {
-			log.Errorf("error publishing: %v", err)
-			conn.errorHandler(err)
+		case data := <-conn.queue:
+			conn.publish(data)
+
+		case <-conn.ctx.Done():
 			return
-		} else if pr != nil && pr.ReasonCode != 0 && pr.ReasonCode != 16 {
-			// 16 = Server received message but there are no subscribers
-			log.Debugf("reason code %d received", pr.ReasonCode)
 		}
+	}
+}
 
-		log.Debugf("sent: %v", data)
-	}()
+func (conn *Connection) publish(data Data) {
+	ctx, cancel := context.WithTimeout(conn.ctx, 100*time.Millisecond)
+	defer cancel()
+
+	// AwaitConnection will return immediately if connection is up; adding this call stops publication whilst
+	// connection is unavailable.
+	if err := conn.connectionManager.AwaitConnection(ctx); err != nil {
+		// Should only happen when context is cancelled
+		log.Errorf("Publish timed out waiting for the connection: %v", err)
+		conn.errorHandler(err)
+	}
+
+	ctx, cancel = context.WithTimeout(conn.ctx, 100*time.Millisecond)
+	defer cancel()
+
+	publish := &paho.Publish{
+		Topic:   data.Topic,
+		Payload: data.Data,
+		Retain:  data.Retain,
+	}
+
+	if len(data.ContentType) > 0 {
+		publish.Properties = &paho.PublishProperties{ContentType: data.ContentType}
+	}
+
+	if pr, err := conn.connectionManager.Publish(ctx, publish); err != nil {
+		log.Errorf("error publishing: %v", err)
+		conn.errorHandler(err)
+		return
+	} else if pr != nil && pr.ReasonCode != 0 && pr.ReasonCode != 16 {
+		// 16 = Server received message but there are no subscribers
+		log.Debugf("reason code %d received", pr.ReasonCode)
+	}
+
+	log.Debugf("sent: %v", data)
+}
+
+// publishStatuses publishes the statuses of a new connection, replacing the
+// will that may have been left by the last
+func (conn *Connection) publishStatuses(cm *autopaho.ConnectionManager) {
+	ctx, cancel := context.WithTimeout(conn.ctx, time.Second)
+	defer cancel()
+
+	/* A status with an Init, like a Homie device's state, is only Online once
+	 * whatever it describes has been published, which it has been if it was
+	 * Online before */
+	for _, status := range conn.statuses {
+		if len(status.Init) == 0 {
+			conn.publishStatus(ctx, cm, status.Topic, status.Online)
+			continue
+		}
+
+		conn.publishStatus(ctx, cm, status.Topic, status.Init)
+
+		conn.mu.Lock()
+		ready := conn.ready[status.Topic]
+		conn.mu.Unlock()
+
+		if ready {
+			conn.publishStatus(ctx, cm, status.Topic, status.Online)
+		}
+	}
 }
 
 func (conn *Connection) Disconnect() error {
 	ctx, cancel := context.WithTimeout(conn.ctx, time.Second)
 	defer cancel()
 
+	/* The broker only sends the will when we go away without saying so */
+	for _, status := range conn.statuses {
+		conn.publishStatus(ctx, conn.connectionManager, status.Topic, status.Offline)
+	}
+
 	return conn.connectionManager.Disconnect(ctx)
 }
 
-func SanitizeTopic(topic string) string {
-	topic = strings.ReplaceAll(topic, " ", "_")
-	topic = strings.ReplaceAll(topic, ".", "_")
-	topic = strings.ReplaceAll(topic, "&", "_")
-
-	return topic
+func (conn *Connection) publishStatus(ctx context.Context, cm *autopaho.ConnectionManager, topic string, status string) {
+	if _, err := cm.Publish(ctx, &paho.Publish{
+		Topic:   topic,
+		Payload: []byte(status),
+		QoS:     1,
+		Retain:  true,
+	}); err != nil {
+		log.Errorf("error publishing status: %v", err)
+	}
 }
 
+// JoinTopic joins topic levels as they are, nothing in them is replaced. The
+// levels that come from the sensors should already have been sanitized by
+// their topic template.
 func JoinTopic(topics ...string) string {
-	return SanitizeTopic(strings.Join(topics, "/"))
+	return strings.Join(topics, "/")
 }
 
 func (conn *Connection) messageHandler(m *paho.Publish) {
@@ -220,6 +355,13 @@ func (conn *Connection) messageHandler(m *paho.Publish) {
 }
 
 func (conn *Connection) connectionUpHandler(cm *autopaho.ConnectionManager, connAck *paho.Connack) {
+	/* The connection's statuses are published ahead of anything published
+	 * after it, one waiting to be is for the same connection manager */
+	select {
+	case conn.connected <- cm:
+	default:
+	}
+
 	conn.mu.Lock()
 	defer conn.mu.Unlock()
 
@@ -238,13 +380,20 @@ func (conn *Connection) errorHandler(err error) {
 	oe := conn.onError.Load()
 
 	if oe == nil {
-		oe = make(chan error)
+		oe = make(chan error, 1)
 		conn.onError.Store(oe)
 	}
 
 	conn.mu.Unlock()
 
-	oe.(chan error) <- err
+	/* Errors come from the publishes, which go one after another, so waiting
+	 * for one to be taken would hold up everything behind it. One is enough
+	 * to have the connection dropped. */
+	select {
+	case oe.(chan error) <- err:
+	default:
+		log.Errorf("dropped mqtt error: %v", err)
+	}
 }
 
 func (conn *Connection) serverDisconnectHandler(d *paho.Disconnect) {
@@ -0,0 +1,108 @@
+package payload
+
+import (
+	"time"
+)
+
+const (
+	// Flat is the original payload, a map of field to value
+	Flat = "flat"
+	// Envelope is the versioned payload that describes its fields
+	Envelope = "envelope"
+
+	// SchemaVersion is bumped whenever the envelope changes in a way that
+	// consumers need to know about
+	SchemaVersion = 1
+
+	// QualityGood is the quality of a field with a usable reading
+	QualityGood = "good"
+)
+
+// Whether each field is published to its own topic as well as in the payload
+const (
+	FieldTopicsOff  = "off"  // only the payload
+	FieldTopicsAlso = "also" // the payload and each field
+	FieldTopicsOnly = "only" // each field without the payload
+)
+
+// Sensor identifies the sensor an observation came from
+type Sensor struct {
+	Model   string `json:"model,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	ID      string `json:"id,omitempty"`
+	Alias   string `json:"alias,omitempty"`
+}
+
+// Field is a single value along with what it means
+type Field struct {
+	Value   interface{} `json:"value,omitempty"` // left out when there is no usable reading
+	Unit    string      `json:"unit,omitempty"`
+	Quality string      `json:"quality,omitempty"`
+}
+
+// Observation is everything that was published for a sensor in one go
+type Observation struct {
+	Schema    int                         `json:"schema"`
+	Time      string                      `json:"time"`      // RFC3339
+	Timestamp int64                       `json:"timestamp"` // seconds since the epoch
+	Sensor    Sensor                      `json:"sensor"`
+	Source    string                      `json:"source"` // receiver that heard the sensor
+	Fields    map[string]Field            `json:"fields"`
+	Records   map[string]map[string]Field `json:"records,omitempty"` // day -> field
+}
+
+// New builds the observation of data, in the units given, at time t. Fields in
+// quality are the ones without a usable reading, and why. Objects in data, the
+// records, are each made into a map of fields.
+func New(t time.Time, sensor Sensor, source string, data map[string]interface{}, units map[string]string, quality map[string]string) Observation {
+	obs := Observation{
+		Schema:    SchemaVersion,
+		Time:      t.Format(time.RFC3339),
+		Timestamp: t.Unix(),
+		Sensor:    sensor,
+		Source:    source,
+		Fields:    make(map[string]Field),
+	}
+
+	for field, val := range data {
+		if object, ok := val.(map[string]interface{}); ok {
+			obs.addRecords(object, units)
+			continue
+		}
+
+		obs.Fields[field] = Field{
+			Value:   val,
+			Unit:    units[field],
+			Quality: QualityGood,
+		}
+	}
+
+	for field, reason := range quality {
+		obs.Fields[field] = Field{
+			Unit:    units[field],
+			Quality: reason,
+		}
+	}
+
+	return obs
+}
+
+func (obs *Observation) addRecords(days map[string]interface{}, units map[string]string) {
+	if obs.Records == nil {
+		obs.Records = make(map[string]map[string]Field)
+	}
+
+	for day, val := range days {
+		records, ok := val.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		fields := make(map[string]Field)
+		for field, v := range records {
+			fields[field] = Field{Value: v, Unit: units[field]}
+		}
+
+		obs.Records[day] = fields
+	}
+}
@@ -0,0 +1,58 @@
+package payload
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	now := time.Date(2021, 7, 23, 3, 15, 46, 0, time.FixedZone("EDT", -4*60*60))
+
+	data := map[string]interface{}{
+		"temp":       68.9,
+		"sunshine":   false,
+		"temp_trend": "rising",
+		"records": map[string]interface{}{
+			"today": map[string]interface{}{"temp_max": 75.6, "temp_max_at": "2021-07-23T01:02:03-04:00"},
+		},
+	}
+	units := map[string]string{"temp": "F", "temp_max": "F", "hum": "%"}
+	quality := map[string]string{"hum": "invalid"}
+
+	obs := New(now, Sensor{Model: "model", ID: "1"}, "shed", data, units, quality)
+
+	if obs.Schema != SchemaVersion || obs.Time != "2021-07-23T03:15:46-04:00" || obs.Timestamp != 1627024546 {
+		t.Errorf("unexpected envelope %v", obs)
+	}
+
+	var tests = []struct {
+		field string
+		want  Field
+	}{
+		{"temp", Field{68.9, "F", QualityGood}},
+		{"sunshine", Field{false, "", QualityGood}},
+		{"temp_trend", Field{"rising", "", QualityGood}},
+		{"hum", Field{nil, "%", "invalid"}},
+	}
+
+	for _, test := range tests {
+		if got := obs.Fields[test.field]; got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.field, test.want, got)
+		}
+	}
+
+	if _, ok := obs.Fields["records"]; ok {
+		t.Errorf("expected the records on their own")
+	}
+
+	if got := obs.Records["today"]["temp_max"]; got != (Field{75.6, "F", ""}) {
+		t.Errorf("unexpected record %v", got)
+	}
+
+	/* A false value is still a value */
+	out, err := json.Marshal(obs.Fields["sunshine"])
+	if err != nil || string(out) != `{"value":false,"quality":"good"}` {
+		t.Errorf("unexpected JSON %s", out)
+	}
+}
@@ -0,0 +1,173 @@
+package psychrometrics
+
+import (
+	"math"
+
+	"github.com/martinlindhe/unit"
+)
+
+/* Magnus-Tetens coefficients over water (Sonntag 1990), good from -45 to 60C */
+const (
+	magnusA = 6.112  // hPa
+	magnusB = 17.62  //
+	magnusC = 243.12 // C
+
+	magnusMinimum = -45.0
+	magnusMaximum = 60.0
+)
+
+func inMagnusRange(t float64, rh float64) bool {
+	return (t >= magnusMinimum) && (t <= magnusMaximum) && (rh > 0) && (rh <= 100)
+}
+
+// SaturationVapourPressure returns the saturation vapour pressure, in hPa, over
+// water at temperature t (C)
+func SaturationVapourPressure(t float64) (float64, bool) {
+	if (t < magnusMinimum) || (t > magnusMaximum) {
+		return 0, false
+	}
+
+	return magnusA * math.Exp((magnusB*t)/(magnusC+t)), true
+}
+
+// VapourPressure returns the actual vapour pressure, in hPa, at temperature t
+// (C) and relative humidity rh (%)
+func VapourPressure(t float64, rh float64) (float64, bool) {
+	if !inMagnusRange(t, rh) {
+		return 0, false
+	}
+
+	es, _ := SaturationVapourPressure(t)
+
+	return es * rh / 100, true
+}
+
+// DewPoint returns the Magnus-Tetens dewpoint, in C, at temperature t (C) and
+// relative humidity rh (%)
+func DewPoint(t float64, rh float64) (float64, bool) {
+	if !inMagnusRange(t, rh) {
+		return 0, false
+	}
+
+	gamma := math.Log(rh/100) + (magnusB*t)/(magnusC+t)
+
+	return magnusC * gamma / (magnusB - gamma), true
+}
+
+// AbsoluteHumidity returns the mass of water vapour, in g/m^3, at temperature t
+// (C) and relative humidity rh (%)
+func AbsoluteHumidity(t float64, rh float64) (float64, bool) {
+	e, ok := VapourPressure(t, rh)
+	if !ok {
+		return 0, false
+	}
+
+	/* 216.7 is 100 (hPa -> Pa) * 1000 (kg -> g) / 461.5 (specific gas constant
+	 * of water vapour, J/(kg K)) */
+	return 216.7 * e / (273.15 + t), true
+}
+
+// HeatIndex returns the NWS heat index, in C, at temperature t (C) and relative
+// humidity rh (%). It is only defined from 26.7C (80F) upwards.
+// https://www.wpc.ncep.noaa.gov/html/heatindex_equation.shtml
+func HeatIndex(t float64, rh float64) (float64, bool) {
+	if (t < 26.7) || (rh < 0) || (rh > 100) {
+		return 0, false
+	}
+
+	f := unit.FromCelsius(t).Fahrenheit()
+
+	/* The simple formula is good enough when the result is under 80F */
+	hi := 0.5 * (f + 61.0 + ((f - 68.0) * 1.2) + (rh * 0.094))
+
+	if (hi+f)/2 >= 80 {
+		hi = -42.379 +
+			2.04901523*f +
+			10.14333127*rh -
+			0.22475541*f*rh -
+			0.00683783*f*f -
+			0.05481717*rh*rh +
+			0.00122874*f*f*rh +
+			0.00085282*f*rh*rh -
+			0.00000199*f*f*rh*rh
+
+		if (rh < 13) && (f >= 80) && (f <= 112) {
+			hi -= ((13 - rh) / 4) * math.Sqrt((17-math.Abs(f-95))/17)
+		} else if (rh > 85) && (f >= 80) && (f <= 87) {
+			hi += ((rh - 85) / 10) * ((87 - f) / 5)
+		}
+	}
+
+	return unit.FromFahrenheit(hi).Celsius(), true
+}
+
+// WindChill returns the North American wind chill index, in C, at temperature
+// t (C) and wind speed v (m/s). It is only defined at or below 10C and for wind
+// speeds above 4.8km/h.
+func WindChill(t float64, v float64) (float64, bool) {
+	kph := (unit.Speed(v) * unit.MetersPerSecond).KilometersPerHour()
+
+	if (t > 10) || (kph <= 4.8) {
+		return 0, false
+	}
+
+	vp := math.Pow(kph, 0.16)
+
+	return 13.12 + 0.6215*t - 11.37*vp + 0.3965*t*vp, true
+}
+
+// Humidex returns the Canadian humidex at temperature t (C) and dewpoint td
+// (C). It is only used from 20C upwards.
+func Humidex(t float64, td float64) (float64, bool) {
+	if t < 20 {
+		return 0, false
+	}
+
+	e := 6.11 * math.Exp(5417.7530*((1/273.16)-(1/(273.15+td))))
+
+	return t + 0.5555*(e-10.0), true
+}
+
+// ApparentTemperature returns the Australian Bureau of Meteorology apparent
+// temperature, in C, at temperature t (C), relative humidity rh (%) and wind
+// speed v (m/s)
+func ApparentTemperature(t float64, rh float64, v float64) (float64, bool) {
+	e, ok := VapourPressure(t, rh)
+	if !ok || (v < 0) {
+		return 0, false
+	}
+
+	return t + 0.33*e - 0.70*v - 4.00, true
+}
+
+// WetBulb returns the wet-bulb temperature, in C, at temperature t (C) and
+// relative humidity rh (%) using Stull's formula, which holds from -20 to 50C and
+// 5 to 99%
+func WetBulb(t float64, rh float64) (float64, bool) {
+	if (t < -20) || (t > 50) || (rh < 5) || (rh > 99) {
+		return 0, false
+	}
+
+	return t*math.Atan(0.151977*math.Sqrt(rh+8.313659)) +
+		math.Atan(t+rh) -
+		math.Atan(rh-1.676331) +
+		0.00391838*math.Pow(rh, 1.5)*math.Atan(0.023101*rh) -
+		4.686035, true
+}
+
+// FeelsLike returns the heat index when it is hot, the wind chill when it is
+// cold and windy, and the temperature t (C) otherwise. The wind speed v (m/s) is
+// optional, pass ok = false when it isn't known.
+func FeelsLike(t float64, rh float64, v float64, vOk bool) float64 {
+	if hi, ok := HeatIndex(t, rh); ok {
+		return hi
+	}
+
+	if vOk {
+		if wc, ok := WindChill(t, v); ok {
+			return wc
+		}
+	}
+
+	return t
+}
@@ -0,0 +1,158 @@
+package psychrometrics
+
+import (
+	"testing"
+
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/math"
+)
+
+func TestDewPoint(t *testing.T) {
+	var tests = []struct {
+		t    float64
+		rh   float64
+		td   float64
+		ok   bool
+		name string
+	}{
+		{20.0, 100.0, 20.0, true, "saturated"},
+		{20.0, 50.0, 9.3, true, "mild"},
+		{30.0, 20.0, 4.6, true, "dry"},
+		{-10.0, 80.0, -12.8, true, "cold"},
+		{20.0, 0.0, 0.0, false, "no humidity"},
+		{70.0, 50.0, 0.0, false, "too hot"},
+	}
+
+	for _, test := range tests {
+		td, ok := DewPoint(test.t, test.rh)
+
+		if ok != test.ok {
+			t.Errorf("%s: expected ok %v, got %v", test.name, test.ok, ok)
+		}
+		if ok && (math.Round(td, 1) != test.td) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.td, td)
+		}
+	}
+}
+
+func TestHeatIndex(t *testing.T) {
+	var tests = []struct {
+		t    float64
+		rh   float64
+		hi   float64
+		ok   bool
+		name string
+	}{
+		{unitF(90), 70.0, 106.0, true, "hot and humid"},
+		{unitF(100), 40.0, 109.0, true, "hot"},
+		{unitF(110), 10.0, 104.0, true, "hot and dry"},
+		{unitF(82), 90.0, 92.0, true, "warm and humid"},
+		{20.0, 50.0, 0.0, false, "too cold"},
+	}
+
+	for _, test := range tests {
+		hi, ok := HeatIndex(test.t, test.rh)
+
+		if ok != test.ok {
+			t.Errorf("%s: expected ok %v, got %v", test.name, test.ok, ok)
+		}
+		if ok && (math.Round(toF(hi), 0) != test.hi) {
+			t.Errorf("%s: expected %vF, got %vF", test.name, test.hi, toF(hi))
+		}
+	}
+}
+
+func TestWindChill(t *testing.T) {
+	var tests = []struct {
+		t    float64
+		v    float64
+		wc   float64
+		ok   bool
+		name string
+	}{
+		{-10.0, 30.0 / 3.6, -19.5, true, "cold and windy"},
+		{0.0, 10.0 / 3.6, -3.3, true, "cold"},
+		{15.0, 10.0, 0.0, false, "too warm"},
+		{-10.0, 1.0, 0.0, false, "too calm"},
+	}
+
+	for _, test := range tests {
+		wc, ok := WindChill(test.t, test.v)
+
+		if ok != test.ok {
+			t.Errorf("%s: expected ok %v, got %v", test.name, test.ok, ok)
+		}
+		if ok && (math.Round(wc, 1) != test.wc) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.wc, wc)
+		}
+	}
+}
+
+func TestHumidex(t *testing.T) {
+	if h, ok := Humidex(30.0, 15.0); !ok || (math.Round(h, 0) != 34.0) {
+		t.Errorf("expected 34, got %v", h)
+	}
+
+	if _, ok := Humidex(15.0, 10.0); ok {
+		t.Errorf("expected humidex to be invalid below 20C")
+	}
+}
+
+func TestApparentTemperature(t *testing.T) {
+	if at, ok := ApparentTemperature(30.0, 50.0, 2.0); !ok || (math.Round(at, 1) != 31.6) {
+		t.Errorf("expected 31.6, got %v", at)
+	}
+
+	if _, ok := ApparentTemperature(30.0, 50.0, -1.0); ok {
+		t.Errorf("expected apparent temperature to be invalid for negative wind")
+	}
+}
+
+func TestWetBulb(t *testing.T) {
+	if tw, ok := WetBulb(20.0, 50.0); !ok || (math.Round(tw, 1) != 13.7) {
+		t.Errorf("expected 13.7, got %v", tw)
+	}
+
+	if _, ok := WetBulb(20.0, 100.0); ok {
+		t.Errorf("expected wet bulb to be invalid at saturation")
+	}
+}
+
+func TestVapourPressure(t *testing.T) {
+	if e, ok := VapourPressure(20.0, 50.0); !ok || (math.Round(e, 2) != 11.66) {
+		t.Errorf("expected 11.66, got %v", e)
+	}
+
+	if ah, ok := AbsoluteHumidity(20.0, 50.0); !ok || (math.Round(ah, 1) != 8.6) {
+		t.Errorf("expected 8.6, got %v", ah)
+	}
+}
+
+func TestFeelsLike(t *testing.T) {
+	var tests = []struct {
+		t    float64
+		rh   float64
+		v    float64
+		vOk  bool
+		fl   float64
+		name string
+	}{
+		{20.0, 50.0, 5.0, true, 20.0, "mild"},
+		{-10.0, 50.0, 30.0 / 3.6, true, -19.5, "wind chill"},
+		{-10.0, 50.0, 0.0, false, -10.0, "no wind"},
+		{unitF(90), 70.0, 0.0, false, 41.1, "heat index"},
+	}
+
+	for _, test := range tests {
+		if fl := FeelsLike(test.t, test.rh, test.v, test.vOk); math.Round(fl, 1) != test.fl {
+			t.Errorf("%s: expected %v, got %v", test.name, test.fl, fl)
+		}
+	}
+}
+
+func unitF(f float64) float64 {
+	return (f - 32) * 5 / 9
+}
+
+func toF(c float64) float64 {
+	return c*9/5 + 32
+}
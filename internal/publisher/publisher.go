@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/homie"
 	"github.com/geoff-coppertop/weather-sensor-bridge/internal/mqtt"
 	log "github.com/sirupsen/logrus"
 )
@@ -15,7 +16,7 @@ func Start(ctx context.Context, wg *sync.WaitGroup, cfg cfg.Config, in <-chan mq
 	var con *mqtt.Connection
 	var err error = nil
 
-	if con, err = mqtt.Connect(ctx, cfg); err != nil {
+	if con, err = mqtt.Connect(ctx, cfg, statuses(cfg)); err != nil {
 		log.Debug("connect failed")
 		log.Debug(err)
 		close(out)
@@ -76,3 +77,33 @@ func Start(ctx context.Context, wg *sync.WaitGroup, cfg cfg.Config, in <-chan mq
 
 	return out
 }
+
+// statuses returns the topics that say whether the bridge is online, the first
+// is the will. Only Home Assistant and Homie need one.
+func statuses(cfg cfg.Config) []mqtt.Status {
+	var statuses []mqtt.Status
+
+	/* A Homie device is lost when the bridge goes away, so its state is the
+	 * will ahead of the bridge's status */
+	if cfg.Homie {
+		statuses = append(statuses, mqtt.Status{
+			Topic:   mqtt.JoinTopic(cfg.HomiePrefix, cfg.HomieDeviceID, homie.StateAttr),
+			Init:    homie.Init,
+			Online:  homie.Ready,
+			Lost:    homie.Lost,
+			Offline: homie.Disconnected,
+		})
+	}
+
+	/* Home Assistant's entities are available while the bridge is */
+	if cfg.HADiscovery {
+		statuses = append(statuses, mqtt.Status{
+			Topic:   mqtt.JoinTopic(cfg.BaseTopic, mqtt.StatusTopic),
+			Online:  mqtt.StatusOnline,
+			Lost:    mqtt.StatusOffline,
+			Offline: mqtt.StatusOffline,
+		})
+	}
+
+	return statuses
+}
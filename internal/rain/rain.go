@@ -0,0 +1,140 @@
+package rain
+
+import (
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+)
+
+/* Once this long has passed without a tip the rain rate is reported as zero,
+ * otherwise it would only ever decay towards zero */
+const rateTimeout = time.Hour
+
+// Status is the rain rate and event information after an update
+type Status struct {
+	Rate float64 // mm/h
+
+	HasEvent      bool // true once at least one rain event has been seen
+	EventActive   bool // true while the latest event is still running
+	EventStart    time.Time
+	EventDuration time.Duration
+	EventTotal    float64 // mm
+}
+
+// Tracker derives rain rate and rain events from a cumulative rain total
+type Tracker struct {
+	clock     acc.Clock
+	dryPeriod time.Duration
+
+	hasTotal  bool
+	lastTotal float64
+
+	hasTip      bool
+	lastTip     time.Time
+	tipAmount   float64
+	hasInterval bool
+	tipInterval time.Duration
+
+	hasEvent   bool
+	eventStart time.Time
+	eventTotal float64
+}
+
+func New(dryPeriod time.Duration, clock acc.Clock) *Tracker {
+	tracker := Tracker{
+		clock:     clock,
+		dryPeriod: dryPeriod,
+	}
+
+	return &tracker
+}
+
+// Update takes the latest cumulative rain total, in mm, and returns the
+// current rain rate and event information
+func (t *Tracker) Update(total float64) Status {
+	now := t.clock.Now()
+
+	/* The first total only gives us a starting point, and a total that goes
+	 * backwards means the sensor has been reset so we start over from it */
+	if !t.hasTotal || total < t.lastTotal {
+		t.hasTotal = true
+		t.lastTotal = total
+
+		return t.status(now)
+	}
+
+	if delta := total - t.lastTotal; delta > 0 {
+		t.tip(now, delta)
+	}
+
+	t.lastTotal = total
+
+	return t.status(now)
+}
+
+func (t *Tracker) tip(now time.Time, amount float64) {
+	/* Tips too far apart say nothing about how hard it is raining now */
+	t.hasInterval = false
+	if t.hasTip {
+		t.tipInterval = now.Sub(t.lastTip)
+		t.hasInterval = (t.tipInterval > 0) && (t.tipInterval < rateTimeout)
+	}
+
+	/* The first tip after a dry period starts a new event */
+	if !t.eventActive(now) {
+		t.hasEvent = true
+		t.eventStart = now
+		t.eventTotal = 0
+	}
+
+	t.hasTip = true
+	t.lastTip = now
+	t.tipAmount = amount
+	t.eventTotal += amount
+}
+
+func (t *Tracker) eventActive(now time.Time) bool {
+	return t.hasEvent && now.Sub(t.lastTip) < t.dryPeriod
+}
+
+func (t *Tracker) status(now time.Time) Status {
+	status := Status{
+		Rate: t.rate(now),
+	}
+
+	if t.hasEvent {
+		status.HasEvent = true
+		status.EventActive = t.eventActive(now)
+		status.EventStart = t.eventStart
+		status.EventTotal = t.eventTotal
+
+		if status.EventActive {
+			status.EventDuration = now.Sub(t.eventStart)
+		} else {
+			status.EventDuration = t.lastTip.Sub(t.eventStart)
+		}
+	}
+
+	return status
+}
+
+func (t *Tracker) rate(now time.Time) float64 {
+	if !t.hasInterval {
+		return 0
+	}
+
+	/* The rate comes from the gap between the last two tips, but if it has
+	 * been longer than that since the last tip the rain must have eased off so
+	 * we use the time since the last tip instead */
+	elapsed := now.Sub(t.lastTip)
+	if elapsed >= rateTimeout {
+		return 0
+	}
+
+	interval := t.tipInterval
+	if elapsed > interval {
+		interval = elapsed
+	}
+
+	return t.tipAmount / interval.Hours()
+}
@@ -0,0 +1,98 @@
+package rain
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func TestRainRate(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	tracker := New(6*time.Hour, clk)
+
+	testData := []struct {
+		total float64
+		delay time.Duration
+		rate  float64
+	}{
+		{10.0, 0, 0.0},                // baseline
+		{10.0, 5 * time.Minute, 0.0},  // no tips
+		{10.3, 5 * time.Minute, 0.0},  // first tip, no interval yet
+		{10.6, 6 * time.Minute, 3.0},  // 0.3mm in 6 minutes
+		{10.6, 3 * time.Minute, 3.0},  // still inside the tip interval
+		{10.6, 6 * time.Minute, 2.0},  // 0.3mm in 9 minutes since the last tip
+		{10.6, 60 * time.Minute, 0.0}, // too long since the last tip
+		{10.9, 5 * time.Minute, 0.0},  // tip interval is too long to use
+		{0.0, 5 * time.Minute, 0.0},   // sensor reset
+	}
+
+	for _, test := range testData {
+		clk.now = clk.now.Add(test.delay)
+
+		status := tracker.Update(test.total)
+
+		if !approxEqual(status.Rate, test.rate) {
+			t.Errorf("expected rate %v, got %v", test.rate, status.Rate)
+		}
+	}
+}
+
+func TestRainEvent(t *testing.T) {
+	start := time.Unix(0, 0)
+	clk := &testClock{now: start}
+	tracker := New(2*time.Hour, clk)
+
+	if status := tracker.Update(1.0); status.HasEvent {
+		t.Errorf("unexpected event")
+	}
+
+	clk.now = clk.now.Add(time.Hour)
+	eventStart := clk.now
+
+	status := tracker.Update(1.3)
+	if !status.HasEvent || !status.EventActive {
+		t.Errorf("expected active event")
+	}
+	if status.EventStart != eventStart {
+		t.Errorf("expected event start %v, got %v", eventStart, status.EventStart)
+	}
+
+	clk.now = clk.now.Add(30 * time.Minute)
+	status = tracker.Update(1.9)
+	if !approxEqual(status.EventTotal, 0.9) {
+		t.Errorf("expected event total 0.9, got %v", status.EventTotal)
+	}
+	if status.EventDuration != 30*time.Minute {
+		t.Errorf("expected event duration 30m, got %v", status.EventDuration)
+	}
+
+	/* Two dry hours end the event, its duration stops at the last tip */
+	clk.now = clk.now.Add(2 * time.Hour)
+	status = tracker.Update(1.9)
+	if !status.HasEvent || status.EventActive {
+		t.Errorf("expected finished event")
+	}
+	if status.EventDuration != 30*time.Minute {
+		t.Errorf("expected event duration 30m, got %v", status.EventDuration)
+	}
+
+	/* The next tip starts a new event */
+	clk.now = clk.now.Add(time.Minute)
+	status = tracker.Update(2.2)
+	if !status.EventActive || status.EventStart != clk.now {
+		t.Errorf("expected new event")
+	}
+	if !approxEqual(status.EventTotal, 0.3) {
+		t.Errorf("expected event total 0.3, got %v", status.EventTotal)
+	}
+}
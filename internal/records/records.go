@@ -0,0 +1,87 @@
+package records
+
+import (
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+	mh "github.com/geoff-coppertop/weather-sensor-bridge/internal/maphelper"
+	log "github.com/sirupsen/logrus"
+)
+
+// Kind is which records are kept for a field
+type Kind int
+
+const (
+	HIGH Kind = 1 << iota
+	LOW
+
+	HIGH_LOW = HIGH | LOW
+)
+
+type record struct {
+	kind Kind
+	acc  *acc.Accumulator
+}
+
+// Tracker keeps the daily high and low of fields along with when they
+// happened, for today and yesterday
+type Tracker struct {
+	records map[string]record
+}
+
+// New creates a tracker for the given fields. newDay must return a new
+// accumulator for a day, aligned to where the day starts.
+func New(fields map[string]Kind, newDay func() *acc.Accumulator) *Tracker {
+	tracker := Tracker{
+		records: make(map[string]record),
+	}
+
+	for field, kind := range fields {
+		tracker.records[field] = record{kind: kind, acc: newDay()}
+	}
+
+	return &tracker
+}
+
+// Update adds the fields in data and returns the records for today and
+// yesterday. Each record is published as <field>_max/<field>_min with the time
+// it happened as <field>_max_at/<field>_min_at.
+func (t *Tracker) Update(data map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	today := make(map[string]interface{})
+	yesterday := make(map[string]interface{})
+
+	for field, rec := range t.records {
+		var stats acc.Stats
+		var err error
+
+		if val, ok := mh.GetFloatValue(data, field); ok {
+			stats, err = rec.acc.Accumulate(val)
+		} else {
+			stats, err = rec.acc.Peek()
+		}
+
+		if err == nil {
+			addRecords(today, field, rec.kind, stats)
+		} else if err != acc.ErrNoData {
+			log.Error(err)
+		}
+
+		if stats, err := rec.acc.Previous(); err == nil {
+			addRecords(yesterday, field, rec.kind, stats)
+		}
+	}
+
+	return today, yesterday
+}
+
+func addRecords(records map[string]interface{}, field string, kind Kind, stats acc.Stats) {
+	if kind&HIGH != 0 {
+		records[field+"_max"] = stats.Maximum
+		records[field+"_max_at"] = stats.MaximumTime.Format(time.RFC3339)
+	}
+
+	if kind&LOW != 0 {
+		records[field+"_min"] = stats.Minimum
+		records[field+"_min_at"] = stats.MinimumTime.Format(time.RFC3339)
+	}
+}
@@ -0,0 +1,69 @@
+package records
+
+import (
+	"testing"
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func TestRecords(t *testing.T) {
+	clk := &testClock{now: time.Date(2021, 7, 23, 12, 0, 0, 0, time.UTC)}
+	newDay := func() *acc.Accumulator {
+		return acc.New(24*time.Hour, clk, acc.CONSECUTIVE)
+	}
+
+	tracker := New(map[string]Kind{"temp": HIGH_LOW, "uv": HIGH}, newDay)
+
+	tracker.Update(map[string]interface{}{"temp": 20.0, "uv": 3.0})
+	lowAt := clk.now.Format(time.RFC3339)
+
+	clk.now = clk.now.Add(time.Hour)
+	today, yesterday := tracker.Update(map[string]interface{}{"temp": 25.0})
+	highAt := clk.now.Format(time.RFC3339)
+
+	expected := map[string]interface{}{
+		"temp_max":    25.0,
+		"temp_max_at": highAt,
+		"temp_min":    20.0,
+		"temp_min_at": lowAt,
+		"uv_max":      3.0,
+		"uv_max_at":   lowAt,
+	}
+
+	if len(today) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, today)
+	}
+	for key, val := range expected {
+		if today[key] != val {
+			t.Errorf("expected %s %v, got %v", key, val, today[key])
+		}
+	}
+
+	if len(yesterday) != 0 {
+		t.Errorf("expected no records for yesterday, got %v", yesterday)
+	}
+
+	/* Tomorrow today's records become yesterday's */
+	clk.now = clk.now.Add(12 * time.Hour)
+	today, yesterday = tracker.Update(map[string]interface{}{"temp": 15.0})
+
+	if today["temp_max"] != 15.0 || today["temp_min"] != 15.0 {
+		t.Errorf("expected new records for today, got %v", today)
+	}
+	if _, ok := today["uv_max"]; ok {
+		t.Errorf("expected no uv record for today, got %v", today)
+	}
+
+	for key, val := range expected {
+		if yesterday[key] != val {
+			t.Errorf("expected yesterday's %s %v, got %v", key, val, yesterday[key])
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/math"
+)
+
+// AnySensor is the sensor of templates that apply to every sensor
+const AnySensor = "*"
+
+// The functions templates can use on top of the built in ones
+var funcs = template.FuncMap{
+	// json writes a value as JSON, e.g. {"temp": {{json .temp}}}
+	"json": func(val interface{}) (string, error) {
+		txData, err := json.Marshal(val)
+		return string(txData), err
+	},
+
+	// round rounds a number to places decimals, e.g. {{round .temp 0}}
+	"round": func(val interface{}, places uint) (float64, error) {
+		switch v := val.(type) {
+		case int:
+			return float64(v), nil
+		case float64:
+			return math.Round(v, places), nil
+		}
+
+		return 0, fmt.Errorf("round needs a number, got %v", val)
+	},
+}
+
+// New parses a payload template, e.g. "{{round .temp 0}}C {{.hum}}%"
+func New(name string, text string) (*template.Template, error) {
+	return template.New(name).Funcs(funcs).Parse(text)
+}
+
+// Execute renders the template against a sensor's data
+func Execute(t *template.Template, data map[string]interface{}) ([]byte, error) {
+	var b bytes.Buffer
+
+	if err := t.Execute(&b, data); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
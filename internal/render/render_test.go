@@ -0,0 +1,57 @@
+package render
+
+import (
+	"testing"
+)
+
+func TestExecute(t *testing.T) {
+	data := map[string]interface{}{
+		"temp":  20.46,
+		"hum":   54,
+		"batt":  false,
+		"units": map[string]string{"temp": "C"},
+	}
+
+	var tests = []struct {
+		template string
+		payload  string
+	}{
+		{"{{.temp}}", "20.46"},
+		{"{{round .temp 1}}{{.units.temp}} {{.hum}}%", "20.5C 54%"},
+		{"{{round .hum 1}}", "54"},
+		{`{"Temp": {{json .temp}}, "Low": {{json .batt}}}`, `{"Temp": 20.46, "Low": false}`},
+		{`{{if .batt}}LOW{{else}}OK{{end}}`, "OK"},
+		{`{{printf "%5.1f" .temp}}`, " 20.5"},
+	}
+
+	for _, test := range tests {
+		tmpl, err := New("test", test.template)
+		if err != nil {
+			t.Fatalf("%s: unexpected error, err: %s", test.template, err)
+		}
+
+		payload, err := Execute(tmpl, data)
+		if err != nil {
+			t.Errorf("%s: unexpected error, err: %s", test.template, err)
+		}
+
+		if string(payload) != test.payload {
+			t.Errorf("%s: expected %q, got %q", test.template, test.payload, payload)
+		}
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	if _, err := New("test", "{{.temp"); err == nil {
+		t.Errorf("expected a parse error")
+	}
+
+	if _, err := New("test", "{{banana .temp}}"); err == nil {
+		t.Errorf("expected an unknown function error")
+	}
+
+	tmpl, _ := New("test", "{{round .units 1}}")
+	if _, err := Execute(tmpl, map[string]interface{}{"units": map[string]string{}}); err == nil {
+		t.Errorf("expected an execution error")
+	}
+}
@@ -0,0 +1,159 @@
+package solar
+
+import (
+	"math"
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+)
+
+const (
+	// SolarConstant is the mean radiation (W/m^2) reaching the top of the
+	// atmosphere, facing the sun
+	SolarConstant = 1361.0
+
+	// SunshineThreshold is the WMO threshold (W/m^2) of direct radiation for
+	// the sun to be shining, below it there can't be sunshine however clear
+	// the sky is
+	SunshineThreshold = 120.0
+)
+
+func rad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func deg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// sun is where the sun is, as seen from a point on the earth
+type sun struct {
+	elevation float64 // degrees above the horizon
+	azimuth   float64 // degrees clockwise from north
+	distance  float64 // earth-sun distance in AU
+}
+
+// position follows the NOAA solar calculator, which is good to within a minute
+// of arc for the years around now. Refraction is ignored.
+// https://gml.noaa.gov/grad/solcalc/calcdetails.html
+func position(t time.Time, latitude float64, longitude float64) sun {
+	julianDay := float64(t.UnixNano())/float64(24*time.Hour) + 2440587.5
+	jc := (julianDay - 2451545) / 36525
+
+	meanLong := math.Mod(280.46646+jc*(36000.76983+jc*0.0003032), 360)
+	meanAnom := 357.52911 + jc*(35999.05029-0.0001537*jc)
+	eccent := 0.016708634 - jc*(0.000042037+0.0000001267*jc)
+
+	eqCentre := math.Sin(rad(meanAnom))*(1.914602-jc*(0.004817+0.000014*jc)) +
+		math.Sin(rad(2*meanAnom))*(0.019993-0.000101*jc) +
+		math.Sin(rad(3*meanAnom))*0.000289
+
+	trueLong := meanLong + eqCentre
+	trueAnom := meanAnom + eqCentre
+	distance := (1.000001018 * (1 - eccent*eccent)) / (1 + eccent*math.Cos(rad(trueAnom)))
+
+	omega := rad(125.04 - 1934.136*jc)
+	appLong := trueLong - 0.00569 - 0.00478*math.Sin(omega)
+	meanObliq := 23 + (26+(21.448-jc*(46.815+jc*(0.00059-jc*0.001813)))/60)/60
+	obliq := meanObliq + 0.00256*math.Cos(omega)
+
+	declination := math.Asin(math.Sin(rad(obliq)) * math.Sin(rad(appLong)))
+
+	/* The equation of time (minutes) is how far the sun is ahead of the clock */
+	y := math.Pow(math.Tan(rad(obliq/2)), 2)
+	eqTime := 4 * deg(y*math.Sin(2*rad(meanLong))-
+		2*eccent*math.Sin(rad(meanAnom))+
+		4*eccent*y*math.Sin(rad(meanAnom))*math.Cos(2*rad(meanLong))-
+		0.5*y*y*math.Sin(4*rad(meanLong))-
+		1.25*eccent*eccent*math.Sin(2*rad(meanAnom)))
+
+	utc := t.UTC()
+	minutes := float64(utc.Hour()*60+utc.Minute()) + float64(utc.Second())/60
+	solarTime := math.Mod(minutes+eqTime+4*longitude, 1440)
+	if solarTime < 0 {
+		solarTime += 1440
+	}
+
+	hourAngle := rad(solarTime/4 - 180)
+	lat := rad(latitude)
+
+	cosZenith := math.Sin(lat)*math.Sin(declination) + math.Cos(lat)*math.Cos(declination)*math.Cos(hourAngle)
+	zenith := math.Acos(math.Max(-1, math.Min(1, cosZenith)))
+
+	/* Measured from north, the sun is east of the meridian in the morning */
+	azimuth := 0.0
+	if sinZenith := math.Sin(zenith); (sinZenith != 0) && (math.Cos(lat) != 0) {
+		cosAzimuth := (math.Sin(lat)*math.Cos(zenith) - math.Sin(declination)) / (math.Cos(lat) * sinZenith)
+		azimuth = deg(math.Acos(math.Max(-1, math.Min(1, cosAzimuth))))
+
+		if hourAngle > 0 {
+			azimuth = math.Mod(azimuth+180, 360)
+		} else {
+			azimuth = math.Mod(540-azimuth, 360)
+		}
+	}
+
+	return sun{
+		elevation: 90 - deg(zenith),
+		azimuth:   azimuth,
+		distance:  distance,
+	}
+}
+
+// Position returns the elevation (degrees above the horizon) and azimuth
+// (degrees clockwise from north) of the sun at t, as seen from latitude and
+// longitude (degrees, north and east are positive)
+func Position(t time.Time, latitude float64, longitude float64) (float64, float64) {
+	s := position(t, latitude, longitude)
+
+	return s.elevation, s.azimuth
+}
+
+// ClearSky returns the radiation (W/m^2) that would reach a horizontal surface
+// at t under a clear sky, using the FAO-56 clear sky transmissivity for the
+// altitude (m) of the station. It is 0 while the sun is down.
+func ClearSky(t time.Time, latitude float64, longitude float64, altitude float64) float64 {
+	s := position(t, latitude, longitude)
+	if s.elevation <= 0 {
+		return 0
+	}
+
+	extraterrestrial := SolarConstant / (s.distance * s.distance) * math.Sin(rad(s.elevation))
+
+	return (0.75 + 2e-5*altitude) * extraterrestrial
+}
+
+// Sunshine returns whether the sun is shining, which is when the measured
+// radiation is at least fraction of the clear sky radiation and the clear sky
+// radiation is above the WMO threshold
+func Sunshine(measured float64, clearSky float64, fraction float64) bool {
+	if clearSky < SunshineThreshold {
+		return false
+	}
+
+	return measured >= fraction*clearSky
+}
+
+// Total tracks a value summed up over time, in value-hours, over a window
+type Total struct {
+	acc *acc.Accumulator
+}
+
+// NewTotal creates a total over the window of the accumulator
+func NewTotal(window *acc.Accumulator) *Total {
+	total := Total{
+		acc: window,
+	}
+
+	return &total
+}
+
+// Update adds a value and returns the total, in value-hours, over the window
+func (t *Total) Update(value float64) (float64, error) {
+	stats, err := t.acc.Accumulate(value)
+	if err != nil {
+		return 0, err
+	}
+
+	return stats.Integral / time.Hour.Seconds(), nil
+}
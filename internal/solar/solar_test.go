@@ -0,0 +1,106 @@
+package solar
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func TestPosition(t *testing.T) {
+	var tests = []struct {
+		name      string
+		t         time.Time
+		latitude  float64
+		longitude float64
+		elevation float64
+		azimuth   float64
+	}{
+		/* Solar noon at the solstice is 90 - latitude + the tilt of the earth */
+		{"toronto solstice noon", time.Date(2021, 6, 21, 17, 19, 36, 0, time.UTC), 43.65, -79.38, 69.79, 180},
+		{"sydney solstice noon", time.Date(2021, 6, 21, 1, 57, 18, 0, time.UTC), -33.87, 151.21, 32.69, 0},
+		{"toronto solstice morning", time.Date(2021, 6, 21, 13, 0, 0, 0, time.UTC), 43.65, -79.38, 33.79, 88.68},
+		{"toronto midnight", time.Date(2021, 6, 21, 5, 0, 0, 0, time.UTC), 43.65, -79.38, -22.76, 355.12},
+	}
+
+	for _, test := range tests {
+		elevation, azimuth := Position(test.t, test.latitude, test.longitude)
+
+		if math.Abs(elevation-test.elevation) > 0.1 {
+			t.Errorf("%s: expected elevation %.2f, got %.2f", test.name, test.elevation, elevation)
+		}
+
+		/* Compare around the circle so that 359.9 is close to 0 */
+		if diff := math.Mod(azimuth-test.azimuth+540, 360) - 180; math.Abs(diff) > 0.5 {
+			t.Errorf("%s: expected azimuth %.2f, got %.2f", test.name, test.azimuth, azimuth)
+		}
+	}
+}
+
+func TestClearSky(t *testing.T) {
+	noon := time.Date(2021, 6, 21, 17, 19, 36, 0, time.UTC)
+
+	/* The earth is near its furthest from the sun in June */
+	expected := 0.75 * SolarConstant / (1.0163 * 1.0163) * math.Sin(69.79*math.Pi/180)
+	if clearSky := ClearSky(noon, 43.65, -79.38, 0); math.Abs(clearSky-expected) > 2 {
+		t.Errorf("expected clear sky %.1f, got %.1f", expected, clearSky)
+	}
+
+	if ClearSky(noon, 43.65, -79.38, 1000) <= ClearSky(noon, 43.65, -79.38, 0) {
+		t.Errorf("expected more radiation at altitude")
+	}
+
+	if clearSky := ClearSky(noon.Add(-12*time.Hour), 43.65, -79.38, 0); clearSky != 0 {
+		t.Errorf("expected no radiation at night, got %.1f", clearSky)
+	}
+}
+
+func TestSunshine(t *testing.T) {
+	var tests = []struct {
+		measured float64
+		clearSky float64
+		sunshine bool
+	}{
+		{700, 900, true},
+		{600, 900, false},
+		{100, 110, false},
+		{0, 0, false},
+	}
+
+	for _, test := range tests {
+		if sunshine := Sunshine(test.measured, test.clearSky, 0.7); sunshine != test.sunshine {
+			t.Errorf("%.0f of %.0f: expected %t, got %t", test.measured, test.clearSky, test.sunshine, sunshine)
+		}
+	}
+}
+
+func TestTotal(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	total := NewTotal(acc.New(24*time.Hour, clk, acc.ROLLING))
+
+	var sum float64
+	for i := 0; i <= 120; i++ {
+		sum, _ = total.Update(500)
+		clk.now = clk.now.Add(time.Minute)
+	}
+
+	if sum != 1000 {
+		t.Errorf("expected 1000 Wh, got %v", sum)
+	}
+
+	/* The sun going down over a minute adds half a minute, the hour of night
+	 * after it adds nothing rather than stretching the average over it */
+	total.Update(0)
+	clk.now = clk.now.Add(time.Hour)
+
+	if sum, _ = total.Update(0); math.Abs(sum-1000-250.0/60) > 1e-9 {
+		t.Errorf("expected %v Wh, got %v", 1000+250.0/60, sum)
+	}
+}
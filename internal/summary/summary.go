@@ -0,0 +1,284 @@
+package summary
+
+import (
+	gomath "math"
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/degreedays"
+	mh "github.com/geoff-coppertop/weather-sensor-bridge/internal/maphelper"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/wind"
+	log "github.com/sirupsen/logrus"
+)
+
+// day is what we keep of each completed day so that it can be rolled up into
+// the month
+type day struct {
+	hasTemp  bool
+	tempMax  float64
+	tempMin  float64
+	tempMean float64
+
+	hasDegreeDays bool
+	hdd           float64
+	cdd           float64
+
+	hasRain bool
+	rain    float64
+
+	hasGust bool
+	gustMax float64
+
+	hasWind  bool
+	windMean float64
+
+	hasDir bool
+	windU  float64
+	windV  float64
+}
+
+// Tracker accumulates what is needed to summarize each day, and the days that
+// make up the month
+type Tracker struct {
+	temp  *acc.Accumulator
+	rain  *acc.Accumulator
+	gust  *acc.Accumulator
+	wspd  *acc.Accumulator
+	windU *acc.Accumulator
+	windV *acc.Accumulator
+
+	degreeDays *degreedays.Tracker
+
+	days []day
+}
+
+// New creates a summary tracker. newDay must return a new accumulator for a
+// day, aligned to where the day starts. The heating and cooling degree days
+// are those degreeDays integrated over the day.
+func New(newDay func() *acc.Accumulator, degreeDays *degreedays.Tracker) *Tracker {
+	tracker := Tracker{
+		temp:       newDay(),
+		rain:       newDay(),
+		gust:       newDay(),
+		wspd:       newDay(),
+		windU:      newDay(),
+		windV:      newDay(),
+		degreeDays: degreeDays,
+	}
+
+	return &tracker
+}
+
+// Update adds the fields in data to today
+func (t *Tracker) Update(data map[string]interface{}) {
+	updates := []struct {
+		key string
+		acc *acc.Accumulator
+	}{
+		{"temp", t.temp},
+		{"rain_acc", t.rain},
+		{"wspd_gust", t.gust},
+		{"wspd", t.wspd},
+	}
+
+	for _, u := range updates {
+		if val, ok := mh.GetFloatValue(data, u.key); ok {
+			if _, err := u.acc.Accumulate(val); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+
+	/* The dominant direction is the direction of the average wind vector, so
+	 * stronger winds count for more */
+	sValue, sOk := mh.GetFloatValue(data, "wspd")
+	dValue, dOk := mh.GetFloatValue(data, "wdir")
+	if sOk && dOk {
+		rad := dValue * gomath.Pi / 180
+
+		if _, err := t.windU.Accumulate(sValue * gomath.Sin(rad)); err != nil {
+			log.Error(err)
+		}
+		if _, err := t.windV.Accumulate(sValue * gomath.Cos(rad)); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// CloseDay summarizes the day that has just ended, which started at start, and
+// keeps it for the month. False is returned if nothing was seen that day.
+func (t *Tracker) CloseDay(start time.Time) (map[string]interface{}, bool) {
+	var d day
+	seen := false
+
+	if stats, err := t.temp.Previous(); err == nil {
+		d.hasTemp = true
+		d.tempMax = stats.Maximum
+		d.tempMin = stats.Minimum
+		d.tempMean = stats.Average
+		seen = true
+	}
+
+	if hdd, cdd, err := t.degreeDays.Previous(); err == nil {
+		d.hasDegreeDays = true
+		d.hdd = hdd
+		d.cdd = cdd
+	}
+
+	/* The gauge's counter can be reset during the day, only what it counted
+	 * up is rain */
+	if stats, err := t.rain.Previous(); err == nil {
+		d.hasRain = true
+		d.rain = stats.Increase
+		seen = true
+	}
+
+	if stats, err := t.gust.Previous(); err == nil {
+		d.hasGust = true
+		d.gustMax = stats.Maximum
+		seen = true
+	}
+
+	if stats, err := t.wspd.Previous(); err == nil {
+		d.hasWind = true
+		d.windMean = stats.Average
+		seen = true
+	}
+
+	uStats, uErr := t.windU.Previous()
+	vStats, vErr := t.windV.Previous()
+	if (uErr == nil) && (vErr == nil) {
+		d.hasDir = true
+		d.windU = uStats.Average
+		d.windV = vStats.Average
+	}
+
+	if !seen {
+		return nil, false
+	}
+
+	t.days = append(t.days, d)
+
+	summary := summarize([]day{d})
+	summary["date"] = start.Format("2006-01-02")
+
+	return summary, true
+}
+
+// CloseMonth summarizes the days closed since the last month was closed, the
+// month is the one containing start. False is returned if there were no days.
+func (t *Tracker) CloseMonth(start time.Time) (map[string]interface{}, bool) {
+	days := t.days
+	t.days = nil
+
+	if len(days) == 0 {
+		return nil, false
+	}
+
+	summary := summarize(days)
+	summary["month"] = start.Format("2006-01")
+	summary["days"] = len(days)
+
+	return summary, true
+}
+
+func summarize(days []day) map[string]interface{} {
+	summary := make(map[string]interface{})
+
+	var tempMax, tempMin, tempMean, hdd, cdd float64
+	var rain, gustMax, windMean, windU, windV float64
+	var tempDays, degreeDays, rainDays, gustDays, windDays, dirDays int
+
+	for _, d := range days {
+		if d.hasTemp {
+			if (tempDays == 0) || (d.tempMax > tempMax) {
+				tempMax = d.tempMax
+			}
+			if (tempDays == 0) || (d.tempMin < tempMin) {
+				tempMin = d.tempMin
+			}
+			tempMean += d.tempMean
+			tempDays++
+		}
+
+		if d.hasDegreeDays {
+			hdd += d.hdd
+			cdd += d.cdd
+			degreeDays++
+		}
+
+		if d.hasRain {
+			rain += d.rain
+			rainDays++
+		}
+
+		if d.hasGust {
+			if (gustDays == 0) || (d.gustMax > gustMax) {
+				gustMax = d.gustMax
+			}
+			gustDays++
+		}
+
+		if d.hasWind {
+			windMean += d.windMean
+			windDays++
+		}
+
+		if d.hasDir {
+			windU += d.windU
+			windV += d.windV
+			dirDays++
+		}
+	}
+
+	if tempDays > 0 {
+		summary["temp_max"] = tempMax
+		summary["temp_min"] = tempMin
+		summary["temp_mean"] = tempMean / float64(tempDays)
+	}
+
+	if degreeDays > 0 {
+		summary["hdd"] = hdd
+		summary["cdd"] = cdd
+	}
+
+	if rainDays > 0 {
+		summary["rain"] = rain
+	}
+
+	if gustDays > 0 {
+		summary["wspd_gust_max"] = gustMax
+	}
+
+	if windDays > 0 {
+		summary["wspd_mean"] = windMean / float64(windDays)
+	}
+
+	/* Without any wind there is no dominant direction */
+	if (dirDays > 0) && ((windU != 0) || (windV != 0)) {
+		dir := gomath.Atan2(windU, windV) * 180 / gomath.Pi
+		if dir < 0 {
+			dir += 360
+		}
+
+		summary["wdir_dominant"] = dir
+		summary["wdir_dominant_cardinal"] = wind.Cardinal(dir)
+	}
+
+	return summary
+}
+
+// DayStart returns the start of the weather day containing t, days start at
+// boundary after midnight in location
+func DayStart(t time.Time, location *time.Location, boundary time.Duration) time.Time {
+	/* Build the start from wall clock time so that it stays put when daylight
+	 * saving changes */
+	local := t.In(location)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, int(boundary.Minutes()), 0, 0, location)
+
+	if start.After(t) {
+		start = start.AddDate(0, 0, -1)
+	}
+
+	return start
+}
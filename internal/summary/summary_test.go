@@ -0,0 +1,168 @@
+package summary
+
+import (
+	gomath "math"
+	"testing"
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/degreedays"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func TestDayStart(t *testing.T) {
+	loc := time.FixedZone("test", -4*60*60)
+
+	var tests = []struct {
+		t        time.Time
+		boundary time.Duration
+		start    time.Time
+	}{
+		{time.Date(2021, 7, 23, 12, 0, 0, 0, loc), 0, time.Date(2021, 7, 23, 0, 0, 0, 0, loc)},
+		{time.Date(2021, 7, 23, 0, 0, 0, 0, loc), 0, time.Date(2021, 7, 23, 0, 0, 0, 0, loc)},
+		{time.Date(2021, 7, 23, 8, 59, 0, 0, loc), 9 * time.Hour, time.Date(2021, 7, 22, 9, 0, 0, 0, loc)},
+		{time.Date(2021, 7, 23, 9, 0, 0, 0, loc), 9 * time.Hour, time.Date(2021, 7, 23, 9, 0, 0, 0, loc)},
+		{time.Date(2021, 7, 23, 2, 0, 0, 0, time.UTC), 0, time.Date(2021, 7, 22, 0, 0, 0, 0, loc)},
+	}
+
+	for _, test := range tests {
+		if start := DayStart(test.t, loc, test.boundary); !start.Equal(test.start) {
+			t.Errorf("%v: expected %v, got %v", test.t, test.start, start)
+		}
+	}
+}
+
+func TestSummaries(t *testing.T) {
+	clk := &testClock{now: time.Date(2021, 7, 30, 12, 0, 0, 0, time.UTC)}
+	newDay := func() *acc.Accumulator {
+		return acc.New(24*time.Hour, clk, acc.CONSECUTIVE)
+	}
+
+	degreeDays := degreedays.New(10, 30, newDay)
+	season := time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	tracker := New(newDay, degreeDays)
+
+	days := []struct {
+		samples []map[string]interface{}
+	}{
+		{[]map[string]interface{}{
+			{"temp": 10.0, "rain_acc": 1.0, "wspd": 2.0, "wspd_gust": 4.0, "wdir": 90},
+			{"temp": 14.0, "rain_acc": 3.0, "wspd": 4.0, "wspd_gust": 8.0, "wdir": 90},
+		}},
+		{[]map[string]interface{}{
+			{"temp": 20.0, "rain_acc": 3.0, "wspd": 1.0, "wspd_gust": 2.0, "wdir": 180},
+			{"temp": 24.0, "rain_acc": 3.5, "wspd": 1.0, "wspd_gust": 3.0, "wdir": 180},
+		}},
+	}
+
+	var daily []map[string]interface{}
+
+	for _, d := range days {
+		for _, sample := range d.samples {
+			tracker.Update(sample)
+			degreeDays.Update(sample["temp"].(float64), clk.now.Truncate(24*time.Hour), season)
+			clk.now = clk.now.Add(time.Hour)
+		}
+
+		/* Move on to the next day and close the one that ended */
+		clk.now = clk.now.Add(22 * time.Hour)
+
+		summary, ok := tracker.CloseDay(clk.now.AddDate(0, 0, -1))
+		if !ok {
+			t.Fatalf("expected a daily summary")
+		}
+		daily = append(daily, summary)
+	}
+
+	expected := map[string]interface{}{
+		"date":                   "2021-07-30",
+		"temp_max":               14.0,
+		"temp_min":               10.0,
+		"temp_mean":              12.0,
+		"hdd":                    0.25,
+		"cdd":                    0.0,
+		"rain":                   2.0,
+		"wspd_gust_max":          8.0,
+		"wspd_mean":              3.0,
+		"wdir_dominant":          90.0,
+		"wdir_dominant_cardinal": "E",
+	}
+
+	for key, val := range expected {
+		if daily[0][key] != val {
+			t.Errorf("expected daily %s %v, got %v", key, val, daily[0][key])
+		}
+	}
+
+	/* An hour going from 2C to 6C above the base */
+	if cdd, _ := daily[1]["cdd"].(float64); gomath.Abs(cdd-1.0/6) > 1e-9 || daily[1]["date"] != "2021-07-31" {
+		t.Errorf("unexpected second day %v", daily[1])
+	}
+
+	/* Nothing was seen on the last day */
+	clk.now = clk.now.Add(24 * time.Hour)
+	if _, ok := tracker.CloseDay(clk.now.AddDate(0, 0, -1)); ok {
+		t.Errorf("unexpected summary for an empty day")
+	}
+
+	monthly, ok := tracker.CloseMonth(time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC))
+	if !ok {
+		t.Fatalf("expected a monthly summary")
+	}
+
+	expected = map[string]interface{}{
+		"month":                  "2021-07",
+		"days":                   2,
+		"temp_max":               24.0,
+		"temp_min":               10.0,
+		"temp_mean":              17.0,
+		"hdd":                    0.25,
+		"cdd":                    1.0 / 6,
+		"rain":                   2.5,
+		"wspd_gust_max":          8.0,
+		"wspd_mean":              2.0,
+		"wdir_dominant_cardinal": "ESE",
+	}
+
+	for key, val := range expected {
+		if monthly[key] != val {
+			t.Errorf("expected monthly %s %v, got %v", key, val, monthly[key])
+		}
+	}
+
+	if _, ok := tracker.CloseMonth(time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)); ok {
+		t.Errorf("unexpected summary for an empty month")
+	}
+}
+
+func TestRainReset(t *testing.T) {
+	clk := &testClock{now: time.Date(2021, 7, 30, 12, 0, 0, 0, time.UTC)}
+	newDay := func() *acc.Accumulator {
+		return acc.New(24*time.Hour, clk, acc.CONSECUTIVE)
+	}
+
+	tracker := New(newDay, degreedays.New(10, 30, newDay))
+
+	/* The gauge counts 1mm, is reset, then counts 0.4mm */
+	for _, rain := range []float64{4.0, 5.0, 0.0, 0.4} {
+		tracker.Update(map[string]interface{}{"rain_acc": rain})
+		clk.now = clk.now.Add(time.Hour)
+	}
+
+	clk.now = clk.now.Add(20 * time.Hour)
+
+	summary, ok := tracker.CloseDay(clk.now.AddDate(0, 0, -1))
+	if !ok {
+		t.Fatalf("expected a daily summary")
+	}
+
+	if summary["rain"] != 1.4 {
+		t.Errorf("expected 1.4mm of rain, got %v", summary["rain"])
+	}
+}
@@ -0,0 +1,254 @@
+package topic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// DefaultBase is the topic everything is published under
+	DefaultBase = "sensor/rtl_433"
+	// DefaultTemplate is the topic a sensor's data is published to
+	DefaultTemplate = "{base}/{model}/{channel}/{id}"
+)
+
+// The variables a template can use. base and site come from the configuration,
+// the rest from the sensor.
+const (
+	Base    = "base"
+	Site    = "site"
+	Model   = "model"
+	Channel = "channel"
+	ID      = "id"
+	Alias   = "alias"
+)
+
+// DefaultReplacements are the characters in the sensor's values that are
+// replaced before they go in a topic
+var DefaultReplacements = map[string]string{
+	" ": "_",
+	".": "_",
+	"&": "_",
+}
+
+var sensorVariables = map[string]bool{Model: true, Channel: true, ID: true, Alias: true}
+
+/* Characters that mean something to MQTT are always replaced in values, so
+ * that a sensor can't add levels or wildcards to a topic */
+var reserved = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// segment is a piece of a template, literal text or a variable with the
+// alternatives to fall back on when it is empty
+type segment struct {
+	literal   string
+	variables []string
+}
+
+// Template builds the topic of each sensor
+type Template struct {
+	segments   []segment
+	fixed      map[string]string // the values of base and site
+	replacer   *strings.Replacer
+	identifies bool // the template uses the sensor's values
+}
+
+// New parses the template, e.g. "weather/{site}/{alias|model}/{channel}/{id}".
+// Values from the sensor have replacements made in them. An error is returned
+// if the template isn't valid, doesn't identify the sensor, or could build a
+// topic with a wildcard in it.
+func New(template string, base string, site string, replacements map[string]string) (*Template, error) {
+	t, err := Parse(template, base, site, replacements)
+	if err != nil {
+		return nil, err
+	}
+
+	if !t.identifies {
+		return nil, fmt.Errorf("template %s must use at least one of {%s}, {%s}, {%s} or {%s}", template, Model, Channel, ID, Alias)
+	}
+
+	return t, nil
+}
+
+// Parse is New for topics that don't have to identify the sensor, like one
+// that only a single sensor publishes to
+func Parse(template string, base string, site string, replacements map[string]string) (*Template, error) {
+	t := Template{
+		fixed: map[string]string{Base: base, Site: site},
+	}
+
+	if err := checkLevels(base); err != nil {
+		return nil, fmt.Errorf("base topic %s %v", base, err)
+	}
+
+	if err := CheckLevel(site); err != nil {
+		return nil, fmt.Errorf("site %s %v", site, err)
+	}
+
+	var err error
+	if t.replacer, err = newReplacer(replacements); err != nil {
+		return nil, err
+	}
+
+	if t.segments, err = parse(template); err != nil {
+		return nil, err
+	}
+
+	for _, s := range t.segments {
+		if err := checkLevels(s.literal); err != nil {
+			return nil, fmt.Errorf("template %s %v", template, err)
+		}
+
+		for _, v := range s.variables {
+			t.identifies = t.identifies || sensorVariables[v]
+		}
+	}
+
+	return &t, nil
+}
+
+func parse(template string) ([]segment, error) {
+	var segments []segment
+
+	for len(template) > 0 {
+		open := strings.IndexByte(template, '{')
+		if open < 0 {
+			segments = append(segments, segment{literal: template})
+			break
+		}
+
+		if open > 0 {
+			segments = append(segments, segment{literal: template[:open]})
+		}
+
+		end := strings.IndexByte(template[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("template has a { without a }")
+		}
+
+		variables := strings.Split(template[open+1:open+end], "|")
+		for _, v := range variables {
+			if _, ok := sensorVariables[v]; !ok && (v != Base) && (v != Site) {
+				return nil, fmt.Errorf("template has an unknown variable {%s}", v)
+			}
+		}
+
+		segments = append(segments, segment{variables: variables})
+		template = template[open+end+1:]
+	}
+
+	for _, s := range segments {
+		if strings.ContainsAny(s.literal, "}") {
+			return nil, fmt.Errorf("template has a } without a {")
+		}
+	}
+
+	return segments, nil
+}
+
+// checkLevels returns an error if the topic levels have wildcards in them
+func checkLevels(levels string) error {
+	if strings.ContainsAny(levels, "+#") {
+		return fmt.Errorf("must not contain the MQTT wildcards + or #")
+	}
+
+	if strings.ContainsRune(levels, 0) {
+		return fmt.Errorf("must not contain a null character")
+	}
+
+	return nil
+}
+
+// CheckLevel returns an error if the value can't be a single topic level
+func CheckLevel(level string) error {
+	if strings.Contains(level, "/") {
+		return fmt.Errorf("must not contain /")
+	}
+
+	return checkLevels(level)
+}
+
+func newReplacer(replacements map[string]string) (*strings.Replacer, error) {
+	/* Longer strings are replaced first, and the order is the same every
+	 * time */
+	from := make([]string, 0, len(replacements))
+	for old, with := range replacements {
+		if len(old) == 0 {
+			return nil, fmt.Errorf("replacements can't replace nothing")
+		}
+
+		if err := CheckLevel(with); err != nil {
+			return nil, fmt.Errorf("replacement for %q %v", old, err)
+		}
+
+		from = append(from, old)
+	}
+
+	sort.Slice(from, func(i, j int) bool {
+		if len(from[i]) != len(from[j]) {
+			return len(from[i]) > len(from[j])
+		}
+		return from[i] < from[j]
+	})
+
+	var pairs []string
+	for _, old := range from {
+		pairs = append(pairs, old, replacements[old])
+	}
+
+	return strings.NewReplacer(pairs...), nil
+}
+
+// Sanitize returns the value with the replacements made, ready to be a single
+// topic level
+func (t *Template) Sanitize(value string) string {
+	return reserved.Replace(t.replacer.Replace(value))
+}
+
+// Execute builds the topic for a sensor from its model, channel, id and alias.
+// Variables without a value fall back on their alternatives, and levels that
+// end up empty are left out. A template that uses the sensor's values needs at
+// least one of them.
+func (t *Template) Execute(sensor map[string]string) (string, error) {
+	var b strings.Builder
+	identified := false
+
+	for _, s := range t.segments {
+		b.WriteString(s.literal)
+
+		for _, v := range s.variables {
+			if value, ok := t.fixed[v]; ok {
+				if len(value) > 0 {
+					b.WriteString(value)
+					break
+				}
+				continue
+			}
+
+			if value := sensor[v]; len(value) > 0 {
+				b.WriteString(t.Sanitize(value))
+				identified = true
+				break
+			}
+		}
+	}
+
+	if t.identifies && !identified {
+		return "", fmt.Errorf("sensor has no topic information")
+	}
+
+	return Join(strings.Split(b.String(), "/")...), nil
+}
+
+// Join joins topic levels, leaving out any that are empty
+func Join(levels ...string) string {
+	joined := make([]string, 0, len(levels))
+
+	for _, level := range levels {
+		if len(level) > 0 {
+			joined = append(joined, level)
+		}
+	}
+
+	return strings.Join(joined, "/")
+}
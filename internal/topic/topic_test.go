@@ -0,0 +1,89 @@
+package topic
+
+import (
+	"testing"
+)
+
+func TestExecute(t *testing.T) {
+	var tests = []struct {
+		template     string
+		replacements map[string]string
+		sensor       map[string]string
+		topic        string
+	}{
+		{DefaultTemplate, DefaultReplacements, map[string]string{Model: "SwitchDoc Labs FT020T AIO", Channel: "0", ID: "123"}, "sensor/rtl_433/SwitchDoc_Labs_FT020T_AIO/0/123"},
+		{DefaultTemplate, DefaultReplacements, map[string]string{Model: "Acme", ID: "123"}, "sensor/rtl_433/Acme/123"},
+		{"wx/{site}/{alias|model}/{id}", DefaultReplacements, map[string]string{Model: "Acme", ID: "1", Alias: "garden"}, "wx/home/garden/1"},
+		{"wx/{site}/{alias|model}/{id}", DefaultReplacements, map[string]string{Model: "Acme", ID: "1"}, "wx/home/Acme/1"},
+		{"wx/{alias|model}-{id}", DefaultReplacements, map[string]string{Model: "Acme", ID: "1"}, "wx/Acme-1"},
+		{"{base}/{model}", map[string]string{" ": "-", "&": "and"}, map[string]string{Model: "Salt & Pepper"}, "sensor/rtl_433/Salt-and-Pepper"},
+		{"{base}/{model}", nil, map[string]string{Model: "a b/c+d#"}, "sensor/rtl_433/a b_c_d_"},
+		/* Longer strings are replaced first */
+		{"{base}/{model}", map[string]string{"a": "1", "ab": "2"}, map[string]string{Model: "abc"}, "sensor/rtl_433/2c"},
+	}
+
+	for _, test := range tests {
+		template, err := New(test.template, DefaultBase, "home", test.replacements)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.template, err)
+		}
+
+		if topic, err := template.Execute(test.sensor); err != nil || topic != test.topic {
+			t.Errorf("%s %v: expected %s, got %s (%v)", test.template, test.sensor, test.topic, topic, err)
+		}
+	}
+}
+
+func TestExecuteNoSensor(t *testing.T) {
+	template, err := New("{base}/{alias|model}", DefaultBase, "", DefaultReplacements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := template.Execute(map[string]string{ID: "1"}); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	var tests = []struct {
+		template     string
+		base         string
+		site         string
+		replacements map[string]string
+	}{
+		{"{base}/{model", DefaultBase, "", nil},
+		{"{base}/model}", DefaultBase, "", nil},
+		{"{base}/{banana}", DefaultBase, "", nil},
+		{"{base}/{site}", DefaultBase, "", nil},
+		{"{base}/+/{model}", DefaultBase, "", nil},
+		{"{base}/#", DefaultBase, "", nil},
+		{DefaultTemplate, "sensor/+", "", nil},
+		{DefaultTemplate, DefaultBase, "home/garden", nil},
+		{DefaultTemplate, DefaultBase, "#", nil},
+		{DefaultTemplate, DefaultBase, "", map[string]string{" ": "+"}},
+		{DefaultTemplate, DefaultBase, "", map[string]string{" ": "/"}},
+		{DefaultTemplate, DefaultBase, "", map[string]string{"": "_"}},
+	}
+
+	for _, test := range tests {
+		if _, err := New(test.template, test.base, test.site, test.replacements); err == nil {
+			t.Errorf("%s %s %s %v: expected an error", test.template, test.base, test.site, test.replacements)
+		}
+	}
+}
+
+func TestParseFixed(t *testing.T) {
+	template, err := Parse("{base}/{site}/sign", DefaultBase, "garden", DefaultReplacements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if topic, err := template.Execute(map[string]string{ID: "1"}); err != nil || topic != "sensor/rtl_433/garden/sign" {
+		t.Errorf("expected sensor/rtl_433/garden/sign, got %s (%v)", topic, err)
+	}
+
+	if _, err := Parse("{base}/#", DefaultBase, "", DefaultReplacements); err == nil {
+		t.Errorf("expected an error")
+	}
+}
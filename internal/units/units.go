@@ -0,0 +1,401 @@
+package units
+
+import (
+	"fmt"
+	gomath "math"
+	"strings"
+
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/math"
+	"github.com/martinlindhe/unit"
+)
+
+const (
+	Metric   = "metric"
+	Imperial = "imperial"
+
+	// DefaultPrecision is the number of decimals values are published with
+	// unless the unit or field says otherwise
+	DefaultPrecision = 2
+)
+
+// quantity is something that is measured, and the units it can be published
+// in. Values are always worked out in the metric unit.
+type quantity struct {
+	metric   string
+	imperial string
+	convert  map[string]func(float64) float64 // from the metric unit to each unit
+}
+
+func identity(v float64) float64 { return v }
+
+var (
+	temperature = &quantity{"C", "F", map[string]func(float64) float64{
+		"C": identity,
+		"F": func(v float64) float64 { return unit.FromCelsius(v).Fahrenheit() },
+		"K": func(v float64) float64 { return unit.FromCelsius(v).Kelvin() },
+	}}
+
+	/* Differences in temperature, e.g. degree days, scale without the offset */
+	temperatureDelta = &quantity{"C", "F", map[string]func(float64) float64{
+		"C": identity,
+		"F": func(v float64) float64 { return v * 9 / 5 },
+		"K": identity,
+	}}
+
+	temperatureRate = &quantity{"C/h", "F/h", map[string]func(float64) float64{
+		"C/h": identity,
+		"F/h": func(v float64) float64 { return v * 9 / 5 },
+	}}
+
+	speed = &quantity{"m/s", "mph", map[string]func(float64) float64{
+		"m/s":  identity,
+		"km/h": func(v float64) float64 { return (unit.Speed(v) * unit.MetersPerSecond).KilometersPerHour() },
+		"mph":  func(v float64) float64 { return (unit.Speed(v) * unit.MetersPerSecond).MilesPerHour() },
+		"kn":   func(v float64) float64 { return (unit.Speed(v) * unit.MetersPerSecond).Knots() },
+		"ft/s": func(v float64) float64 { return (unit.Speed(v) * unit.MetersPerSecond).FeetPerSecond() },
+	}}
+
+	depth = &quantity{"mm", "in", map[string]func(float64) float64{
+		"mm": identity,
+		"cm": func(v float64) float64 { return (unit.Length(v) * unit.Millimeter).Centimeters() },
+		"in": func(v float64) float64 { return (unit.Length(v) * unit.Millimeter).Inches() },
+	}}
+
+	depthRate = &quantity{"mm/h", "in/h", map[string]func(float64) float64{
+		"mm/h": identity,
+		"in/h": func(v float64) float64 { return (unit.Length(v) * unit.Millimeter).Inches() },
+	}}
+
+	distance = &quantity{"km", "mi", map[string]func(float64) float64{
+		"km": identity,
+		"mi": func(v float64) float64 { return (unit.Length(v) * unit.Kilometer).Miles() },
+		"nm": func(v float64) float64 { return (unit.Length(v) * unit.Kilometer).NauticalMiles() },
+	}}
+
+	pressure = &quantity{"hPa", "inHg", map[string]func(float64) float64{
+		"hPa":  identity,
+		"kPa":  func(v float64) float64 { return (unit.Pressure(v) * unit.Hectopascal).Kilopascals() },
+		"inHg": func(v float64) float64 { return (unit.Pressure(v) * unit.Hectopascal).InchOfMercury() },
+	}}
+)
+
+// fixed is a quantity that is published the same way whatever the system
+func fixed(name string) *quantity {
+	return &quantity{name, name, map[string]func(float64) float64{name: identity}}
+}
+
+var (
+	percent       = fixed("%")
+	percentRate   = fixed("%/h")
+	angle         = fixed("deg")
+	direction     = fixed("deg") // an angle within [0, 360)
+	illuminance   = fixed("lux")
+	irradiance    = fixed("W/m^2")
+	insolation    = fixed("kWh/m^2")
+	hours         = fixed("h")
+	minutes       = fixed("min")
+	concentration = fixed("g/m^3")
+)
+
+// fields is the registry of the fields we publish and what they measure. Fields
+// that aren't here, like the UV index, have no unit.
+var fields = map[string]*quantity{
+	"temp":          temperature,
+	"dewpoint":      temperature,
+	"feels_like":    temperature,
+	"heat_index":    temperature,
+	"apparent_temp": temperature,
+	"wetbulb":       temperature,
+	"wind_chill":    temperature,
+
+	"temp_trend_1h":     temperatureRate,
+	"dewpoint_trend_1h": temperatureRate,
+
+	"gdd_today":  temperatureDelta,
+	"gdd_season": temperatureDelta,
+	"hdd_today":  temperatureDelta,
+	"hdd_season": temperatureDelta,
+	"cdd_today":  temperatureDelta,
+	"cdd_season": temperatureDelta,
+	"hdd":        temperatureDelta,
+	"cdd":        temperatureDelta,
+
+	"hum":          percent,
+	"hum_trend_1h": percentRate,
+
+	"wspd":           speed,
+	"wspd_2m":        speed,
+	"wspd_gust":      speed,
+	"wspd_gust_10m":  speed,
+	"wspd_gust_24hr": speed,
+
+	"wdir":           direction,
+	"wdir_2m":        direction,
+	"wdir_gust_10m":  direction,
+	"wdir_gust_24hr": direction,
+	"wdir_dominant":  direction,
+	"sun_elev":       angle,
+	"sun_azimuth":    direction,
+
+	"wind_run_24hr": distance,
+
+	"rain_acc":       depth,
+	"rain_1hr":       depth,
+	"rain_24hr":      depth,
+	"rain_event_acc": depth,
+	"rain":           depth,
+	"et0":            depth,
+	"et0_today":      depth,
+	"et0_hourly":     depth,
+	"deficit":        depth,
+	"allowed":        depth,
+	"etc":            depth,
+
+	"rain_rate":          depthRate,
+	"rain_rate_1hr_max":  depthRate,
+	"rain_rate_24hr_max": depthRate,
+
+	"vapour_pressure": pressure,
+	"abs_hum":         concentration,
+
+	"light":           illuminance,
+	"solar":           irradiance,
+	"solar_clear_sky": irradiance,
+	"insolation_24hr": insolation,
+	"sunshine_24hr":   hours,
+
+	"chill_hours_today":  hours,
+	"chill_hours_season": hours,
+
+	"rain_event_dur": minutes,
+	"uv_burn_1":      minutes,
+	"uv_burn_2":      minutes,
+	"uv_burn_3":      minutes,
+	"uv_burn_4":      minutes,
+	"uv_burn_5":      minutes,
+	"uv_burn_6":      minutes,
+}
+
+/* Numbers that have no unit, they are still rounded */
+var unitless = map[string]bool{
+	"uv":       true,
+	"humidex":  true,
+	"beaufort": true,
+}
+
+/* Fields made from others, like the daily records, measure the same thing */
+var suffixes = []string{"_max", "_min", "_mean", "_raw"}
+
+// Some units need more decimals to say as much as the metric ones
+var unitPrecision = map[string]uint{
+	"in":      3,
+	"in/h":    3,
+	"inHg":    3,
+	"kWh/m^2": 3,
+	"min":     0,
+}
+
+// lookup returns the field, or the field it was made from, that is registered
+func lookup(field string) (string, *quantity, bool) {
+	if q, ok := fields[field]; ok {
+		return field, q, true
+	}
+
+	for _, suffix := range suffixes {
+		if base := strings.TrimSuffix(field, suffix); base != field {
+			if q, ok := fields[base]; ok {
+				return base, q, true
+			}
+		}
+	}
+
+	return "", nil, false
+}
+
+// baseField returns the field, or the field it was made from, that has no
+// unit, false if it isn't one
+func baseField(field string) (string, bool) {
+	if unitless[field] {
+		return field, true
+	}
+
+	for _, suffix := range suffixes {
+		if base := strings.TrimSuffix(field, suffix); unitless[base] {
+			return base, true
+		}
+	}
+
+	return "", false
+}
+
+// Converter publishes fields in the chosen units and precision
+type Converter struct {
+	system    string
+	overrides map[string]string
+	precision map[string]uint
+}
+
+// New creates a converter for the unit system, metric or imperial, with units
+// and precision (decimals) overridden per field
+func New(system string, overrides map[string]string, precision map[string]uint) (*Converter, error) {
+	if (system != Metric) && (system != Imperial) {
+		return nil, fmt.Errorf("unknown unit system %s, it must be %s or %s", system, Metric, Imperial)
+	}
+
+	if err := CheckOverrides(overrides); err != nil {
+		return nil, err
+	}
+
+	if err := CheckPrecision(precision); err != nil {
+		return nil, err
+	}
+
+	converter := Converter{
+		system:    system,
+		overrides: overrides,
+		precision: precision,
+	}
+
+	return &converter, nil
+}
+
+// CheckOverrides returns an error if a field can't be published in its
+// overridden unit
+func CheckOverrides(overrides map[string]string) error {
+	for field, u := range overrides {
+		q, ok := fields[field]
+		if !ok {
+			return fmt.Errorf("unknown field %s", field)
+		}
+
+		if _, ok := q.convert[u]; !ok {
+			return fmt.Errorf("field %s can't be published in %s", field, u)
+		}
+	}
+
+	return nil
+}
+
+// CheckPrecision returns an error if a field's precision is set but it isn't a
+// field that is published as a number
+func CheckPrecision(precision map[string]uint) error {
+	for field := range precision {
+		if _, _, ok := lookup(field); ok {
+			continue
+		}
+
+		if _, ok := baseField(field); !ok {
+			return fmt.Errorf("unknown field %s", field)
+		}
+	}
+
+	return nil
+}
+
+// Unit returns the unit the field is published in, false if it has none
+func (c *Converter) Unit(field string) (string, bool) {
+	base, q, ok := lookup(field)
+	if !ok {
+		return "", false
+	}
+
+	if u, ok := c.overrides[base]; ok {
+		return u, true
+	}
+
+	if c.system == Imperial {
+		return q.imperial, true
+	}
+
+	return q.metric, true
+}
+
+// Convert returns a copy of data, and of any objects within it, with the
+// fields in the units they are published in and rounded. The units of the
+// fields that have one are returned too.
+func (c *Converter) Convert(data map[string]interface{}) (map[string]interface{}, map[string]string) {
+	units := make(map[string]string)
+
+	return c.convert(data, units), units
+}
+
+func (c *Converter) convert(data map[string]interface{}, units map[string]string) map[string]interface{} {
+	converted := make(map[string]interface{}, len(data))
+
+	for field, val := range data {
+		converted[field] = val
+
+		if nested, ok := val.(map[string]interface{}); ok {
+			converted[field] = c.convert(nested, units)
+			continue
+		}
+
+		base, q, ok := lookup(field)
+		if !ok {
+			/* Numbers without a unit are only rounded */
+			if v, isFloat := val.(float64); isFloat {
+				base, _ = baseField(field)
+				converted[field] = math.Round(v, c.fieldPrecision(field, base, ""))
+			}
+			continue
+		}
+
+		u, _ := c.Unit(field)
+		units[field] = u
+
+		/* Leave whole numbers alone unless they need converting, so that
+		 * they stay whole */
+		var v float64
+		switch n := val.(type) {
+		case float64:
+			v = n
+		case int:
+			if u == q.metric {
+				continue
+			}
+			v = float64(n)
+		default:
+			continue
+		}
+
+		rounded := math.Round(q.convert[u](v), c.fieldPrecision(field, base, u))
+		/* Directions are wrapped after rounding so that 359.999 is 0, not
+		 * 360 */
+		if q == direction {
+			rounded = wrap(rounded)
+		}
+
+		converted[field] = rounded
+	}
+
+	return converted
+}
+
+// fieldPrecision returns the decimals the field is published with, set for the
+// field, for the field it was made from, or by its unit u
+func (c *Converter) fieldPrecision(field string, base string, u string) uint {
+	if precision, ok := c.precision[field]; ok {
+		return precision
+	}
+
+	if precision, ok := c.precision[base]; ok {
+		return precision
+	}
+
+	if precision, ok := unitPrecision[u]; ok {
+		return precision
+	}
+
+	return DefaultPrecision
+}
+
+// wrap returns a direction in degrees within [0, 360)
+func wrap(v float64) float64 {
+	v = gomath.Mod(v, 360)
+	if v < 0 {
+		v += 360
+	}
+
+	/* Mod keeps the sign of a zero */
+	return gomath.Abs(v)
+}
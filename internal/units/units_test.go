@@ -0,0 +1,138 @@
+package units
+
+import (
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	var tests = []struct {
+		system    string
+		overrides map[string]string
+		precision map[string]uint
+		field     string
+		input     interface{}
+		output    interface{}
+		unit      string
+	}{
+		{Metric, nil, nil, "temp", 20.0, 20.0, "C"},
+		{Metric, nil, nil, "temp", 20.126, 20.13, "C"},
+		{Imperial, nil, nil, "temp", 20.0, 68.0, "F"},
+		{Imperial, nil, nil, "temp_raw", 30.0, 86.0, "F"},
+		{Imperial, nil, nil, "dewpoint_trend_1h", 1.0, 1.8, "F/h"},
+		{Imperial, nil, nil, "gdd_season", 10.0, 18.0, "F"},
+		{Imperial, nil, nil, "wspd", 10.0, 22.37, "mph"},
+		{Imperial, nil, nil, "rain_acc", 1.0, 0.039, "in"},
+		{Imperial, nil, nil, "rain_24hr", 12.7, 0.5, "in"},
+		{Imperial, nil, nil, "rain_rate_24hr_max", 25.4, 1.0, "in/h"},
+		{Imperial, nil, nil, "vapour_pressure", 10.0, 0.295, "inHg"},
+		{Imperial, nil, nil, "wind_run_24hr", 16.09344, 10.0, "mi"},
+		{Imperial, nil, nil, "hum", 50.0, 50.0, "%"},
+		{Imperial, map[string]string{"wspd": "km/h"}, nil, "wspd", 10.0, 36.0, "km/h"},
+		{Imperial, map[string]string{"wspd": "km/h"}, nil, "wspd_2m", 10.0, 22.37, "mph"},
+		{Metric, map[string]string{"rain_acc": "in"}, nil, "rain_acc", 1.0, 0.039, "in"},
+		{Imperial, nil, map[string]uint{"temp": 1}, "temp", 21.13, 70.0, "F"},
+		{Imperial, nil, map[string]uint{"rain_24hr": 2}, "rain_24hr", 12.7, 0.5, "in"},
+		{Imperial, nil, map[string]uint{"temp": 0}, "temp_max", 21.13, 70.0, "F"},
+		{Imperial, nil, map[string]uint{"temp": 4}, "temp", 20.5555, 68.9999, "F"},
+		{Metric, nil, nil, "insolation_24hr", 1.23456, 1.235, "kWh/m^2"},
+		{Metric, nil, nil, "uv_burn_2", 69.44, 69.0, "min"},
+		/* Directions are wrapped once they are rounded */
+		{Metric, nil, nil, "wdir", 359.996, 0.0, "deg"},
+		{Metric, nil, nil, "wdir_gust_10m", 359.5, 359.5, "deg"},
+		{Metric, nil, nil, "sun_azimuth", 359.999, 0.0, "deg"},
+		{Metric, nil, nil, "sun_elev", -5.5, -5.5, "deg"},
+		/* Whole numbers stay whole unless they are converted */
+		{Metric, nil, nil, "wdir", 180, 180, "deg"},
+		{Imperial, nil, nil, "rain_event_dur", 5, 5, "min"},
+		{Imperial, nil, nil, "wspd_gust", 1, 2.24, "mph"},
+		/* Fields without a unit are only rounded */
+		{Imperial, nil, nil, "uv", 2.456, 2.46, ""},
+		{Imperial, nil, map[string]uint{"uv": 1}, "uv", 2.456, 2.5, ""},
+		{Imperial, nil, map[string]uint{"humidex": 0}, "humidex_max", 31.6, 32.0, ""},
+		{Imperial, nil, nil, "beaufort", 3, 3, ""},
+		{Imperial, nil, nil, "temp_trend", "rising", "rising", ""},
+	}
+
+	for _, test := range tests {
+		converter, err := New(test.system, test.overrides, test.precision)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data := map[string]interface{}{test.field: test.input}
+		converted, units := converter.Convert(data)
+
+		if converted[test.field] != test.output {
+			t.Errorf("%s %s %v: expected %v, got %v", test.system, test.field, test.input, test.output, converted[test.field])
+		}
+
+		if units[test.field] != test.unit {
+			t.Errorf("%s %s: expected %q, got %q", test.system, test.field, test.unit, units[test.field])
+		}
+
+		if data[test.field] != test.input {
+			t.Errorf("%s %s: the data was changed to %v", test.system, test.field, data[test.field])
+		}
+	}
+}
+
+func TestConvertNested(t *testing.T) {
+	converter, err := New(Imperial, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"temp": 20.0,
+		"records": map[string]interface{}{
+			"today": map[string]interface{}{"temp_max": 30.0, "temp_max_at": "2021-07-23T14:02:31Z"},
+		},
+	}
+
+	converted, units := converter.Convert(data)
+
+	today := converted["records"].(map[string]interface{})["today"].(map[string]interface{})
+	if today["temp_max"] != 86.0 || today["temp_max_at"] != "2021-07-23T14:02:31Z" {
+		t.Errorf("unexpected records, got %v", today)
+	}
+
+	if units["temp_max"] != "F" {
+		t.Errorf("expected the record's unit, got %v", units)
+	}
+
+	if original := data["records"].(map[string]interface{})["today"].(map[string]interface{}); original["temp_max"] != 30.0 {
+		t.Errorf("the records were changed, got %v", original)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	var tests = []struct {
+		system    string
+		overrides map[string]string
+	}{
+		{"cubits", nil},
+		{"", nil},
+		{Metric, map[string]string{"temp": "mph"}},
+		{Metric, map[string]string{"banana": "mm"}},
+		/* Overrides are for the fields themselves, not what's made from them */
+		{Metric, map[string]string{"temp_max": "F"}},
+	}
+
+	for _, test := range tests {
+		if _, err := New(test.system, test.overrides, nil); err == nil {
+			t.Errorf("%s %v: expected an error", test.system, test.overrides)
+		}
+	}
+}
+
+func TestCheckPrecision(t *testing.T) {
+	if err := CheckPrecision(map[string]uint{"temp": 1, "rain_24hr_max": 3, "uv": 1, "humidex_max": 0}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, field := range []string{"banana", "uv_colour", "wdir_cardinal"} {
+		if err := CheckPrecision(map[string]uint{field: 1}); err == nil {
+			t.Errorf("%s: expected an error", field)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package weather
+
+import (
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/alert"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/mqtt"
+	log "github.com/sirupsen/logrus"
+)
+
+const AlertsTopic = "alerts"
+
+// buildAlerts builds a message for each alert, published on the alerts topic
+// under the base topic
+func (stn *station) buildAlerts(alerts []alert.Alert) []mqtt.Data {
+	var wxData []mqtt.Data
+
+	for _, a := range alerts {
+		txData, err := stn.encoder.Encode(a)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		wxData = append(wxData, mqtt.Data{
+			Topic:       mqtt.JoinTopic(stn.cfg.BaseTopic, AlertsTopic),
+			Data:        txData,
+			ContentType: stn.encoder.ContentType(),
+		})
+	}
+
+	return wxData
+}
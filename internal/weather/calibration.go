@@ -0,0 +1,83 @@
+package weather
+
+import (
+	gomath "math"
+
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+	mh "github.com/geoff-coppertop/weather-sensor-bridge/internal/maphelper"
+)
+
+// AnySensor is the calibration key that applies to every sensor, calibrations
+// for a specific sensor take priority over it
+const AnySensor = "*"
+
+// calibrateData corrects the normalized data in place using the calibrations
+// configured for the sensor
+func calibrateData(config cfg.Config, sensor string, data map[string]interface{}) {
+	/* Take the fields up front since raw values get added as we go */
+	fields := make([]string, 0, len(data))
+	for field := range data {
+		fields = append(fields, field)
+	}
+
+	for _, field := range fields {
+		cal, ok := findCalibration(config.Calibration, sensor, field)
+		if !ok {
+			continue
+		}
+
+		val, ok := mh.GetFloatValue(data, field)
+		if !ok {
+			continue
+		}
+
+		if config.PublishRaw {
+			data[field+"_raw"] = data[field]
+		}
+
+		/* Keep integer fields as integers so the published data looks the
+		 * same whether or not it has been calibrated. Directions are wrapped
+		 * after rounding so that 359.6 is 0, not 360. */
+		_, isInt := data[field].(int)
+
+		calibrated := applyCalibration(cal, val)
+		if isInt {
+			calibrated = gomath.Round(calibrated)
+		}
+
+		if cal.Rotation != 0 {
+			calibrated = wrapDirection(calibrated)
+		}
+
+		if isInt {
+			data[field] = int(calibrated)
+		} else {
+			data[field] = calibrated
+		}
+	}
+}
+
+func findCalibration(cals map[string]map[string]cfg.Calibration, sensor string, field string) (cfg.Calibration, bool) {
+	if cal, ok := cals[sensor][field]; ok {
+		return cal, true
+	}
+
+	cal, ok := cals[AnySensor][field]
+
+	return cal, ok
+}
+
+func applyCalibration(cal cfg.Calibration, val float64) float64 {
+	return val*cal.Multiplier + cal.Offset + cal.Rotation
+}
+
+// wrapDirection returns a direction in degrees within [0, 360)
+func wrapDirection(val float64) float64 {
+	val = gomath.Mod(val, 360)
+	if val < 0 {
+		val += 360
+	}
+
+	/* Directions that round to -0 are 0 */
+	return gomath.Abs(val)
+}
@@ -0,0 +1,58 @@
+package weather
+
+import (
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/degreedays"
+	mh "github.com/geoff-coppertop/weather-sensor-bridge/internal/maphelper"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/summary"
+)
+
+// degreeDayState is what we keep for the agricultural indices, along with
+// where the days and season start
+type degreeDayState struct {
+	tracker     *degreedays.Tracker
+	location    *time.Location
+	boundary    time.Duration
+	seasonMonth time.Month
+	seasonDay   int
+	clock       acc.Clock
+}
+
+func newDegreeDayState(cfg cfg.Config, clock acc.Clock, newDay func() *acc.Accumulator) *degreeDayState {
+	state := degreeDayState{
+		tracker:     degreedays.New(cfg.GDDBase, cfg.GDDCap, newDay),
+		location:    cfg.Location,
+		boundary:    cfg.DayBoundary,
+		seasonMonth: cfg.SeasonMonth,
+		seasonDay:   cfg.SeasonDay,
+		clock:       clock,
+	}
+
+	return &state
+}
+
+// synthesizeDegreeDays adds the growing, heating and cooling degree days and
+// chill hours of today and of the season so far
+func synthesizeDegreeDays(state *degreeDayState, data map[string]interface{}) {
+	tValue, tOk := mh.GetFloatValue(data, "temp")
+	if !tOk {
+		return
+	}
+
+	dayStart := summary.DayStart(state.clock.Now(), state.location, state.boundary)
+	seasonStart := degreedays.SeasonStart(dayStart, state.seasonMonth, state.seasonDay)
+
+	totals := state.tracker.Update(tValue, dayStart, seasonStart)
+
+	data["gdd_today"] = totals.GDD
+	data["gdd_season"] = totals.GDDSeason
+	data["hdd_today"] = totals.HDD
+	data["hdd_season"] = totals.HDDSeason
+	data["cdd_today"] = totals.CDD
+	data["cdd_season"] = totals.CDDSeason
+	data["chill_hours_today"] = totals.ChillHours
+	data["chill_hours_season"] = totals.ChillHoursSeason
+}
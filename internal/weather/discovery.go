@@ -0,0 +1,174 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	ha "github.com/geoff-coppertop/weather-sensor-bridge/internal/homeassistant"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/mqtt"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/payload"
+	log "github.com/sirupsen/logrus"
+)
+
+// AvailabilityTopic is where, under the sensor's topic, Home Assistant is told
+// whether the sensor is still being heard from
+const AvailabilityTopic = "availability"
+
+// discoveryState is what Home Assistant has been told about a sensor
+type discoveryState struct {
+	configs   map[string]string // field -> discovery config topic
+	available bool
+	lastSeen  time.Time
+}
+
+func newDiscoveryState() *discoveryState {
+	state := discoveryState{
+		configs: make(map[string]string),
+	}
+
+	return &state
+}
+
+// discover publishes retained Home Assistant discovery config for each field of
+// data that hasn't been seen from the sensor before, and marks the sensor as
+// available. input is what the sensor sent.
+func (stn *station) discover(topic string, state *sensorState, input map[string]interface{}, data map[string]interface{}) []mqtt.Data {
+	disc := state.discovery
+	disc.lastSeen = stn.clock.Now()
+
+	var wxData []mqtt.Data
+
+	if !disc.available {
+		disc.available = true
+		wxData = append(wxData, availability(topic, ha.Online))
+	}
+
+	converted, fieldUnits := stn.units.Convert(data)
+	nodeID := ha.NodeID(state.key)
+
+	device := ha.Device{
+		Identifiers: []string{"weather_sensor_bridge_" + nodeID},
+		Name:        stn.cfg.SensorAliases[state.key],
+		Model:       identifier(input, "model"),
+	}
+	if len(device.Name) == 0 {
+		device.Name = state.key
+	}
+
+	for field, val := range converted {
+		if _, ok := disc.configs[field]; ok {
+			continue
+		}
+
+		if _, ok := fieldValue(val); !ok {
+			continue
+		}
+
+		component := ha.Component(val)
+		config := ha.Config{
+			Name:        ha.Name(field),
+			UniqueID:    nodeID + "_" + field,
+			DeviceClass: ha.DeviceClass(field),
+			StateClass:  ha.StateClass(field, val, fieldUnits[field]),
+			Unit:        ha.Unit(fieldUnits[field]),
+			Availability: []ha.Availability{
+				{Topic: mqtt.JoinTopic(stn.cfg.BaseTopic, mqtt.StatusTopic)},
+				{Topic: mqtt.JoinTopic(topic, AvailabilityTopic)},
+			},
+			AvailabilityMode: "all",
+			Device:           device,
+		}
+
+		if component == ha.BinarySensor {
+			config.PayloadOn, config.PayloadOff = ha.On, ha.Off
+		}
+
+		config.StateTopic, config.ValueTemplate = stn.stateTopic(topic, field, component)
+
+		txData, err := json.Marshal(config)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		configTopic := mqtt.JoinTopic(stn.cfg.HAPrefix, component, nodeID, field, "config")
+		disc.configs[field] = configTopic
+
+		wxData = append(wxData, mqtt.Data{
+			Topic:  configTopic,
+			Data:   txData,
+			Retain: true,
+		})
+	}
+
+	return wxData
+}
+
+// stateTopic returns where Home Assistant finds the field's state, and the
+// template that gets it out of the payload
+func (stn *station) stateTopic(topic string, field string, component string) (string, string) {
+	/* Field topics have the plain value */
+	if (stn.cfg.FieldTopics == payload.FieldTopicsAlso) || (stn.cfg.FieldTopics == payload.FieldTopicsOnly) {
+		return mqtt.JoinTopic(topic, field), ""
+	}
+
+	value := fmt.Sprintf("value_json.%s", field)
+	if stn.cfg.PayloadFormat == payload.Envelope {
+		value = fmt.Sprintf("value_json.fields.%s.value", field)
+	}
+
+	if component == ha.BinarySensor {
+		return topic, fmt.Sprintf("{{ '%s' if %s else '%s' }}", ha.On, value, ha.Off)
+	}
+
+	return topic, fmt.Sprintf("{{ %s }}", value)
+}
+
+// checkDiscovery marks the sensors that haven't been heard from for a while as
+// unavailable, and removes the ones that have been gone for longer from Home
+// Assistant. They are discovered again if they come back.
+func (stn *station) checkDiscovery() []mqtt.Data {
+	now := stn.clock.Now()
+
+	var wxData []mqtt.Data
+
+	for topic, state := range stn.sensors {
+		disc := state.discovery
+		if len(disc.configs) == 0 {
+			continue
+		}
+
+		quiet := now.Sub(disc.lastSeen)
+
+		if disc.available && (quiet >= stn.cfg.HAOfflineTime) {
+			disc.available = false
+			wxData = append(wxData, availability(topic, ha.Offline))
+		}
+
+		if quiet < stn.cfg.HARemoveTime {
+			continue
+		}
+
+		log.Infof("removing %s from Home Assistant, it hasn't been heard from for %v", state.key, quiet)
+
+		/* An empty retained message removes the entity, and the retained
+		 * availability along with it */
+		for field, configTopic := range disc.configs {
+			wxData = append(wxData, mqtt.Data{Topic: configTopic, Retain: true})
+			delete(disc.configs, field)
+		}
+
+		wxData = append(wxData, mqtt.Data{Topic: mqtt.JoinTopic(topic, AvailabilityTopic), Retain: true})
+	}
+
+	return wxData
+}
+
+func availability(topic string, status string) mqtt.Data {
+	return mqtt.Data{
+		Topic:  mqtt.JoinTopic(topic, AvailabilityTopic),
+		Data:   []byte(status),
+		Retain: true,
+	}
+}
@@ -0,0 +1,215 @@
+package weather
+
+import (
+	gomath "math"
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/et0"
+	mh "github.com/geoff-coppertop/weather-sensor-bridge/internal/maphelper"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/solar"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/summary"
+	log "github.com/sirupsen/logrus"
+)
+
+/* Rs/Rso for the first night, until a day has been seen. Clear to partly
+ * cloudy. */
+const defaultRadiationRatio = 0.8
+
+// et0Inputs are the fields reference evapotranspiration is worked out from
+var et0Inputs = []string{"temp", "hum", "wspd", "solar"}
+
+// et0State is what we keep to work out the reference evapotranspiration. The
+// hourly values are added up through the day, the daily value is worked out
+// from the whole day when it ends. The hours of the day that ended last are
+// kept until its summary has them.
+type et0State struct {
+	position *cfg.Position // nil if the station position wasn't configured
+	location *time.Location
+	boundary time.Duration
+	clock    acc.Clock
+
+	hour     map[string]*acc.Accumulator
+	clearSky *acc.Accumulator
+	day      map[string]*acc.Accumulator
+
+	hourStart time.Time
+	dayStart  time.Time
+	ratio     float64
+	hasToday  bool
+	today     float64
+
+	previousStart time.Time
+	hasPrevious   bool
+	previous      float64
+}
+
+func newET0State(cfg cfg.Config, clock acc.Clock, newDay func() *acc.Accumulator) *et0State {
+	newHour := func() *acc.Accumulator {
+		return acc.New(time.Hour, clock, acc.CONSECUTIVE).Align(cfg.Location, 0)
+	}
+
+	state := et0State{
+		position: cfg.Position,
+		location: cfg.Location,
+		boundary: cfg.DayBoundary,
+		clock:    clock,
+		hour:     make(map[string]*acc.Accumulator),
+		clearSky: newHour(),
+		day:      make(map[string]*acc.Accumulator),
+		ratio:    defaultRadiationRatio,
+	}
+
+	for _, field := range et0Inputs {
+		state.hour[field] = newHour()
+		state.day[field] = newDay()
+	}
+
+	return &state
+}
+
+// synthesizeET0 adds the reference evapotranspiration of the hours of today
+// that have ended as et0_today, it needs the station position
+func synthesizeET0(state *et0State, data map[string]interface{}) {
+	if state.position == nil {
+		return
+	}
+
+	now := state.clock.Now()
+
+	/* Finish the last hour before anything from this one is added */
+	state.roll(now)
+
+	for _, field := range et0Inputs {
+		if val, ok := mh.GetFloatValue(data, field); ok {
+			if _, err := state.hour[field].Accumulate(val); err != nil {
+				log.Error(err)
+			}
+			if _, err := state.day[field].Accumulate(val); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+
+	pos := state.position
+	if _, err := state.clearSky.Accumulate(solar.ClearSky(now, pos.Latitude, pos.Longitude, pos.Elevation)); err != nil {
+		log.Error(err)
+	}
+
+	if state.hasToday {
+		data["et0_today"] = state.today
+	}
+}
+
+// roll closes the hour, and the day, that have ended by now. The last hour of a
+// day still counts towards it, it is added before the day is kept as the
+// previous one.
+func (state *et0State) roll(now time.Time) {
+	local := now.In(state.location)
+	hourStart := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, state.location)
+	dayStart := summary.DayStart(now, state.location, state.boundary)
+
+	if !hourStart.Equal(state.hourStart) {
+		state.closeHour()
+		state.hourStart = hourStart
+	}
+
+	if !dayStart.Equal(state.dayStart) {
+		state.previousStart = state.dayStart
+		state.hasPrevious = state.hasToday
+		state.previous = state.today
+
+		state.hasToday = false
+		state.today = 0
+		state.dayStart = dayStart
+	}
+}
+
+// closeHour adds the hour that has just ended to today, as long as all of the
+// inputs were seen during it
+func (state *et0State) closeHour() {
+	stats := make(map[string]acc.Stats)
+
+	for _, field := range et0Inputs {
+		s, err := state.hour[field].Previous()
+		if err != nil {
+			return
+		}
+		stats[field] = s
+	}
+
+	clearSky, err := state.clearSky.Previous()
+	if err != nil {
+		return
+	}
+
+	/* W/m^2 over the hour to MJ/m^2 */
+	hour := et0.Hour{
+		Temp:      stats["temp"].Average,
+		Hum:       stats["hum"].Average,
+		Wind:      stats["wspd"].Average,
+		Radiation: stats["solar"].Average * 3600 / 1e6,
+		ClearSky:  clearSky.Average * 3600 / 1e6,
+		Ratio:     state.ratio,
+	}
+
+	/* Keep the last daytime ratio for the night, FAO-56 has it taken from
+	 * before sunset */
+	if hour.ClearSky > 0 {
+		state.ratio = gomath.Min(1, hour.Radiation/hour.ClearSky)
+	}
+
+	state.today += et0.Hourly(hour, state.position.Elevation)
+	state.hasToday = true
+}
+
+// closeDay adds the reference evapotranspiration of the day that has just
+// ended, which started at start, to its daily summary. Along with the daily
+// value, the day's hours added up are et0_hourly.
+func (state *et0State) closeDay(start time.Time, daily map[string]interface{}) {
+	if state.position == nil {
+		return
+	}
+
+	/* Nothing may have arrived since the day ended, its last hour is closed
+	 * here if so */
+	state.roll(state.clock.Now())
+
+	if state.hasPrevious && state.previousStart.Equal(start) {
+		daily["et0_hourly"] = state.previous
+		state.hasPrevious = false
+	}
+
+	temp, err := state.day["temp"].Previous()
+	if err != nil {
+		return
+	}
+
+	day := et0.Day{
+		TempMax: temp.Maximum,
+		TempMin: temp.Minimum,
+	}
+
+	if hum, err := state.day["hum"].Previous(); err == nil {
+		day.HasHum = true
+		day.HumMax = hum.Maximum
+		day.HumMin = hum.Minimum
+	}
+
+	if wspd, err := state.day["wspd"].Previous(); err == nil {
+		day.HasWind = true
+		day.Wind = wspd.Average
+	}
+
+	/* W/m^2 over the day to MJ/m^2 */
+	if rad, err := state.day["solar"].Previous(); err == nil {
+		day.HasRadiation = true
+		day.Radiation = rad.Average * 86400 / 1e6
+	}
+
+	value, method := et0.Daily(day, state.position.Latitude, state.position.Elevation, start.YearDay())
+
+	daily["et0"] = value
+	daily["et0_method"] = method
+}
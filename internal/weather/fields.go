@@ -0,0 +1,76 @@
+package weather
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/mqtt"
+)
+
+// AnyField is the retain key that applies to every field, fields that are
+// listed take priority over it
+const AnyField = "*"
+
+// publishedField is what was last published on a field's own topic
+type publishedField struct {
+	value string
+	at    time.Time
+}
+
+// buildFields publishes each field of data as a plain value to its own topic
+// under the sensor's topic, <sensor topic>/<field>. A field is only published
+// when its value has changed, or when it hasn't been published for the
+// refresh period. Objects, like the records, aren't published this way.
+func (stn *station) buildFields(topic string, state *sensorState, data map[string]interface{}) []mqtt.Data {
+	now := stn.clock.Now()
+	converted, _ := stn.units.Convert(data)
+
+	var wxData []mqtt.Data
+
+	for field, val := range converted {
+		value, ok := fieldValue(val)
+		if !ok {
+			continue
+		}
+
+		last, ok := state.fields[field]
+		if ok && (last.value == value) && (now.Sub(last.at) < stn.cfg.FieldRefresh) {
+			continue
+		}
+
+		state.fields[field] = publishedField{value: value, at: now}
+
+		wxData = append(wxData, mqtt.Data{
+			Topic:  mqtt.JoinTopic(topic, field),
+			Data:   []byte(value),
+			Retain: stn.retainField(field),
+		})
+	}
+
+	return wxData
+}
+
+// retainField returns whether the field is retained on its own topic
+func (stn *station) retainField(field string) bool {
+	if retain, ok := stn.cfg.FieldRetain[field]; ok {
+		return retain
+	}
+
+	return stn.cfg.FieldRetain[AnyField]
+}
+
+// fieldValue returns val as it is published on its own, false if it can't be
+func fieldValue(val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int:
+		return strconv.Itoa(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+
+	return "", false
+}
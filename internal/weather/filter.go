@@ -0,0 +1,109 @@
+package weather
+
+import (
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/flatline"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/mqtt"
+	log "github.com/sirupsen/logrus"
+)
+
+const DiagnosticsTopic = "diagnostics"
+
+// The limits of what we believe the sensor can report, in normalized units.
+// Rates are per minute and are left off of fields that can change abruptly.
+// The rain gauge's count only falls when it is reset, so only its rises are
+// rate limited.
+var defaultLimits = map[string]cfg.Limit{
+	"temp":      {Min: limit(-50), Max: limit(70), Rate: limit(1)},
+	"hum":       {Min: limit(0), Max: limit(100), Rate: limit(10)},
+	"wspd":      {Min: limit(0), Max: limit(60)},
+	"wspd_gust": {Min: limit(0), Max: limit(75)},
+	"wdir":      {Min: limit(0), Max: limit(359)},
+	"rain_acc":  {Min: limit(0), Rate: limit(10), Counter: boolean(true)},
+	"light":     {Min: limit(0), Max: limit(200000)},
+	"uv":        {Min: limit(0), Max: limit(20)},
+}
+
+func limit(val float64) *float64 {
+	return &val
+}
+
+func boolean(val bool) *bool {
+	return &val
+}
+
+// The fields that are checked for flatlining. The levels are the ends of the
+// sensor's range, next to its error values, where a failing sensor tends to
+// get stuck. Humidity sits at 99-100% through fog and rain, so only the bottom
+// of its range is a level.
+var defaultFlatlineRules = map[string]flatline.Rule{
+	"temp": {Tolerance: 0.1, Levels: []flatline.Range{{Min: -50, Max: -39}, {Min: 59, Max: 70}}},
+	"hum":  {Tolerance: 1, Levels: []flatline.Range{{Min: 0, Max: 1}}},
+}
+
+// flatlineRules returns the default flatline rules with any configured
+// tolerances applied
+func flatlineRules(tolerances map[string]float64) map[string]flatline.Rule {
+	rules := make(map[string]flatline.Rule)
+
+	for field, rule := range defaultFlatlineRules {
+		rules[field] = rule
+	}
+
+	for field, tolerance := range tolerances {
+		rule := rules[field]
+		rule.Tolerance = tolerance
+		rules[field] = rule
+	}
+
+	return rules
+}
+
+// filterData drops any values from the normalized data that fail the sensor's
+// filter, along with their raw values. The rejected fields are returned.
+func filterData(state *sensorState, data map[string]interface{}) []string {
+	var fields []string
+
+	for field, err := range state.filter.Apply(data) {
+		log.Warnf("rejected %s: %v", field, err)
+
+		delete(data, field+"_raw")
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// flaggedFields returns the flags of the fields in data that have stopped
+// changing, they are still published but their readings may not be real
+func flaggedFields(state *sensorState, data map[string]interface{}) map[string]string {
+	flags := make(map[string]string)
+
+	for field, flag := range state.flatline.Flags() {
+		if _, ok := data[field]; ok {
+			flags[field] = flag
+		}
+	}
+
+	return flags
+}
+
+// buildDiagnostics builds the diagnostics message for a sensor, published on a
+// subtopic of the sensor's topic
+func (stn *station) buildDiagnostics(topic string, state *sensorState) (mqtt.Data, error) {
+	diagnostics := map[string]interface{}{
+		"rejected": state.filter.Rejected(),
+		"flags":    state.flatline.Flags(),
+	}
+
+	txData, err := stn.encoder.Encode(diagnostics)
+	if err != nil {
+		return mqtt.Data{}, err
+	}
+
+	return mqtt.Data{
+		Topic:       mqtt.JoinTopic(topic, DiagnosticsTopic),
+		Data:        txData,
+		ContentType: stn.encoder.ContentType(),
+	}, nil
+}
@@ -0,0 +1,154 @@
+package weather
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/homie"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/mqtt"
+)
+
+// homieDevice is what has been published about the bridge as a Homie device
+type homieDevice struct {
+	described bool            // the device's own attributes have been published
+	nodes     map[string]bool // the ids of the sensors' nodes
+}
+
+// homieNode is what has been published about a sensor as a node of the device
+type homieNode struct {
+	id         string
+	properties map[string]bool // the ids of the fields' properties
+}
+
+func newHomieDevice() *homieDevice {
+	device := homieDevice{
+		nodes: make(map[string]bool),
+	}
+
+	return &device
+}
+
+func newHomieNode() *homieNode {
+	node := homieNode{
+		properties: make(map[string]bool),
+	}
+
+	return &node
+}
+
+// describe publishes the sensor's data as the properties of its node. The
+// first time the sensor, or one of its fields, is seen the device goes back to
+// init while it is described, and is ready again afterwards. input is what the
+// sensor sent.
+func (stn *station) describe(state *sensorState, input map[string]interface{}, data map[string]interface{}) []mqtt.Data {
+	converted, fieldUnits := stn.units.Convert(data)
+	node := state.node
+
+	var attrs []mqtt.Data
+	var values []mqtt.Data
+
+	if !stn.device.described {
+		name := stn.cfg.Receiver
+		if len(name) == 0 {
+			name = stn.cfg.HomieDeviceID
+		}
+
+		attrs = append(attrs,
+			stn.homieAttr(homie.HomieAttr, homie.Version),
+			stn.homieAttr(homie.NameAttr, name),
+			stn.homieAttr(homie.ImplAttr, homie.DefaultDeviceID),
+		)
+	}
+
+	newNode := len(node.id) == 0
+	if newNode {
+		node.id = homie.ID(state.key)
+
+		name := stn.cfg.SensorAliases[state.key]
+		if len(name) == 0 {
+			name = state.key
+		}
+
+		attrs = append(attrs,
+			stn.homieAttr(node.id+"/"+homie.NameAttr, name),
+			stn.homieAttr(node.id+"/"+homie.TypeAttr, identifier(input, "model")),
+		)
+	}
+
+	newProperties := false
+	for field, val := range converted {
+		datatype, ok := homie.Datatype(val)
+		if !ok {
+			continue
+		}
+
+		value, _ := fieldValue(val)
+		property := homie.ID(field)
+
+		values = append(values, mqtt.Data{
+			Topic:  mqtt.JoinTopic(stn.cfg.HomiePrefix, stn.cfg.HomieDeviceID, node.id, property),
+			Data:   []byte(value),
+			Retain: true,
+		})
+
+		if node.properties[property] {
+			continue
+		}
+
+		node.properties[property] = true
+		newProperties = true
+
+		attrs = append(attrs,
+			stn.homieAttr(node.id+"/"+property+"/"+homie.NameAttr, homie.Name(field)),
+			stn.homieAttr(node.id+"/"+property+"/"+homie.DatatypeAttr, datatype),
+		)
+
+		if u, ok := fieldUnits[field]; ok && (len(u) > 0) {
+			attrs = append(attrs, stn.homieAttr(node.id+"/"+property+"/"+homie.UnitAttr, homie.Unit(u)))
+		}
+	}
+
+	if newProperties {
+		attrs = append(attrs, stn.homieAttr(node.id+"/"+homie.PropertiesAttr, list(node.properties)))
+	}
+
+	if newNode {
+		stn.device.nodes[node.id] = true
+		attrs = append(attrs, stn.homieAttr(homie.NodesAttr, list(stn.device.nodes)))
+	}
+
+	if len(attrs) == 0 {
+		return values
+	}
+
+	stn.device.described = true
+
+	wxData := []mqtt.Data{stn.homieAttr(homie.StateAttr, homie.Init)}
+	wxData = append(wxData, attrs...)
+	wxData = append(wxData, stn.homieAttr(homie.StateAttr, homie.Ready))
+
+	return append(wxData, values...)
+}
+
+// homieAttr returns the retained attribute of the device at path, e.g.
+// <node>/<property>/$datatype
+func (stn *station) homieAttr(path string, value string) mqtt.Data {
+	return mqtt.Data{
+		Topic:  mqtt.JoinTopic(stn.cfg.HomiePrefix, stn.cfg.HomieDeviceID, path),
+		Data:   []byte(value),
+		Retain: true,
+	}
+}
+
+// list returns the ids as the comma separated list Homie uses, in order so it
+// is the same each time
+func list(ids map[string]bool) string {
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+
+	sort.Strings(sorted)
+
+	return strings.Join(sorted, ",")
+}
@@ -0,0 +1,55 @@
+package weather
+
+import (
+	"time"
+
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/irrigation"
+	mh "github.com/geoff-coppertop/weather-sensor-bridge/internal/maphelper"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/mqtt"
+)
+
+const IrrigationTopic = "irrigation"
+
+// irrigate runs the water balance of each zone that follows the sensor for the
+// day that has just ended, which started at start. The advice is published
+// retained to <sensor topic>/irrigation/<zone>. Zones need the day's reference
+// evapotranspiration, a day without rain is taken as no rain.
+func (stn *station) irrigate(topic string, state *sensorState, start time.Time, daily map[string]interface{}) []mqtt.Data {
+	et0, ok := mh.GetFloatValue(daily, "et0")
+	if !ok {
+		return nil
+	}
+
+	rain, _ := mh.GetFloatValue(daily, "rain")
+
+	var wxData []mqtt.Data
+
+	for name, zone := range stn.cfg.IrrigationZones {
+		if (zone.Sensor != AnySensor) && (zone.Sensor != state.key) {
+			continue
+		}
+
+		balance, ok := state.zones[name]
+		if !ok {
+			balance = irrigation.New(zone)
+			state.zones[name] = balance
+		}
+
+		advice := balance.Update(rain, et0)
+
+		data := map[string]interface{}{
+			"date":           start.Format("2006-01-02"),
+			"recommendation": advice.Recommendation,
+			"deficit":        advice.Deficit,
+			"allowed":        advice.Allowed,
+			"rain":           advice.Rain,
+			"etc":            advice.ETc,
+		}
+
+		if d, err := stn.buildSummary(mqtt.JoinTopic(topic, IrrigationTopic, name), data); err == nil {
+			wxData = append(wxData, d)
+		}
+	}
+
+	return wxData
+}
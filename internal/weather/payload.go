@@ -0,0 +1,56 @@
+package weather
+
+import (
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/payload"
+)
+
+// buildPayload builds what is published for the sensor with key from its
+// data, in the configured format. input is what the sensor sent, it identifies
+// the sensor in the envelope. Fields in flags are published along with their
+// flag as their quality.
+func (stn *station) buildPayload(key string, input map[string]interface{}, data map[string]interface{}, quality map[string]string, flags map[string]string) ([]byte, error) {
+	if stn.cfg.PayloadFormat != payload.Envelope {
+		flat := stn.convert(data)
+
+		if (len(quality) > 0) || (len(flags) > 0) {
+			fieldQuality := make(map[string]string)
+			for field, flag := range flags {
+				fieldQuality[field] = flag
+			}
+			for field, reason := range quality {
+				fieldQuality[field] = reason
+			}
+
+			flat["quality"] = fieldQuality
+		}
+
+		return stn.encoder.Encode(flat)
+	}
+
+	converted, fieldUnits := stn.units.Convert(data)
+
+	/* Fields without a reading still have a unit */
+	for field := range quality {
+		if u, ok := stn.units.Unit(field); ok {
+			fieldUnits[field] = u
+		}
+	}
+
+	sensor := payload.Sensor{
+		Model:   identifier(input, "model"),
+		Channel: identifier(input, "channel"),
+		ID:      identifier(input, "id"),
+		Alias:   stn.cfg.SensorAliases[key],
+	}
+
+	obs := payload.New(stn.clock.Now(), sensor, stn.cfg.Receiver, converted, fieldUnits, quality)
+
+	for field, flag := range flags {
+		if f, ok := obs.Fields[field]; ok && (f.Quality == payload.QualityGood) {
+			f.Quality = flag
+			obs.Fields[field] = f
+		}
+	}
+
+	return stn.encoder.Encode(obs)
+}
@@ -0,0 +1,81 @@
+package weather
+
+import (
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+	mh "github.com/geoff-coppertop/weather-sensor-bridge/internal/maphelper"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/solar"
+	log "github.com/sirupsen/logrus"
+)
+
+// solarState is what we keep to describe the sun at the station
+type solarState struct {
+	position   *cfg.Position // nil if the station position wasn't configured
+	fraction   float64
+	clock      acc.Clock
+	sunshine   *solar.Total
+	insolation *solar.Total
+}
+
+func newSolarState(cfg cfg.Config, clock acc.Clock, newDay func() *acc.Accumulator) *solarState {
+	state := solarState{
+		position:   cfg.Position,
+		fraction:   cfg.SunshineFraction,
+		clock:      clock,
+		sunshine:   solar.NewTotal(newDay()),
+		insolation: solar.NewTotal(newDay()),
+	}
+
+	return &state
+}
+
+// synthesizeSolar adds where the sun is and the clear sky radiation, which
+// need the station position, and from the measured radiation whether the sun
+// is shining and the day's totals
+func synthesizeSolar(state *solarState, data map[string]interface{}) {
+	sValue, sOk := mh.GetFloatValue(data, "solar")
+
+	if sOk {
+		insolation, err := state.insolation.Update(sValue)
+		if err != nil {
+			log.Error(err)
+		} else {
+			data["insolation_24hr"] = insolation / 1000
+		}
+	}
+
+	if state.position == nil {
+		return
+	}
+
+	now := state.clock.Now()
+	pos := state.position
+
+	elevation, azimuth := solar.Position(now, pos.Latitude, pos.Longitude)
+	clearSky := solar.ClearSky(now, pos.Latitude, pos.Longitude, pos.Elevation)
+
+	data["sun_elev"] = elevation
+	data["sun_azimuth"] = azimuth
+	data["solar_clear_sky"] = clearSky
+
+	if !sOk {
+		return
+	}
+
+	sunshine := solar.Sunshine(sValue, clearSky, state.fraction)
+	data["sunshine"] = sunshine
+
+	/* Summing up 1 while the sun shines gives the hours of sunshine */
+	flag := 0.0
+	if sunshine {
+		flag = 1
+	}
+
+	hours, err := state.sunshine.Update(flag)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	data["sunshine_24hr"] = hours
+}
@@ -0,0 +1,236 @@
+package weather
+
+import (
+	"fmt"
+	"sort"
+	"text/template"
+	"time"
+
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/mqtt"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/render"
+	tp "github.com/geoff-coppertop/weather-sensor-bridge/internal/topic"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/units"
+	log "github.com/sirupsen/logrus"
+)
+
+// payloadTemplate is a payload template that is ready to render
+type payloadTemplate struct {
+	name   string
+	sensor string
+	topic  *tp.Template
+	text   *template.Template
+	retain bool
+}
+
+// newTemplates returns the configured payload templates in name order, any
+// that don't parse are left out
+func newTemplates(cfg cfg.Config) []payloadTemplate {
+	var templates []payloadTemplate
+
+	for _, name := range templateNames(cfg) {
+		tmpl, err := newTemplate(cfg, name)
+		if err != nil {
+			log.Errorf("%v, it won't be published", err)
+			continue
+		}
+
+		templates = append(templates, tmpl)
+	}
+
+	return templates
+}
+
+// templateNames returns the names of the payload templates in order
+func templateNames(cfg cfg.Config) []string {
+	names := make([]string, 0, len(cfg.Templates))
+	for name := range cfg.Templates {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// newTemplate parses the payload template with name
+func newTemplate(cfg cfg.Config, name string) (payloadTemplate, error) {
+	tmpl := cfg.Templates[name]
+
+	topic, err := tp.Parse(tmpl.Topic, cfg.BaseTopic, cfg.Site, cfg.TopicReplace)
+	if err != nil {
+		return payloadTemplate{}, fmt.Errorf("template %s %v", name, err)
+	}
+
+	text, err := render.New(name, tmpl.Template)
+	if err != nil {
+		return payloadTemplate{}, fmt.Errorf("template %s %v", name, err)
+	}
+
+	return payloadTemplate{
+		name:   name,
+		sensor: tmpl.Sensor,
+		topic:  topic,
+		text:   text,
+		retain: tmpl.Retain,
+	}, nil
+}
+
+// buildTemplates renders the payload templates that apply to the sensor with
+// key. input is what the sensor sent, it fills in the template's topic.
+func (stn *station) buildTemplates(key string, input map[string]interface{}, data map[string]interface{}, quality map[string]string) []mqtt.Data {
+	values := stn.templateData(key, data, quality)
+
+	var wxData []mqtt.Data
+
+	for _, tmpl := range stn.templates {
+		if (tmpl.sensor != render.AnySensor) && (tmpl.sensor != key) {
+			continue
+		}
+
+		d, err := stn.render(tmpl, key, input, values)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		wxData = append(wxData, d)
+	}
+
+	return wxData
+}
+
+// templateData is what templates are rendered against, the sensor's data in
+// the units it is published in along with,
+//   - sensor, the sensor's key
+//   - alias, the sensor's alias
+//   - time, when the data was received
+//   - quality, why fields were left out, if any were
+//   - units, the units of the fields
+func (stn *station) templateData(key string, data map[string]interface{}, quality map[string]string) map[string]interface{} {
+	values := stn.convert(data)
+
+	values["sensor"] = key
+	values["alias"] = stn.cfg.SensorAliases[key]
+	values["time"] = stn.clock.Now().Format(time.RFC3339)
+
+	if len(quality) > 0 {
+		values["quality"] = quality
+	}
+
+	return values
+}
+
+func (stn *station) render(tmpl payloadTemplate, key string, input map[string]interface{}, values map[string]interface{}) (mqtt.Data, error) {
+	sensor := stn.identity(input)
+	sensor[tp.Alias] = stn.cfg.SensorAliases[key]
+
+	topic, err := tmpl.topic.Execute(sensor)
+	if err != nil {
+		return mqtt.Data{}, fmt.Errorf("template %s %v", tmpl.name, err)
+	}
+
+	txData, err := render.Execute(tmpl.text, values)
+	if err != nil {
+		return mqtt.Data{}, err
+	}
+
+	return mqtt.Data{
+		Topic:  topic,
+		Data:   txData,
+		Retain: tmpl.retain,
+	}, nil
+}
+
+// samplePacket returns what a SwitchDoc Labs FT020T sends, as it is decoded by
+// rtl_433
+func samplePacket() map[string]interface{} {
+	return map[string]interface{}{
+		"time":           "2021-07-23 03:15:46",
+		"model":          "SwitchDoc Labs FT020T AIO",
+		"device":         12.0,
+		"id":             0.0,
+		"batterylow":     0.0,
+		"avewindspeed":   10.0,
+		"gustwindspeed":  10.0,
+		"winddirection":  100.0,
+		"cumulativerain": 3.0,
+		"temperature":    1089.0,
+		"humidity":       54.0,
+		"light":          38.0,
+		"uv":             10.0,
+		"mic":            "CRC",
+	}
+}
+
+// CheckTemplates renders each payload template against the data of a sample
+// packet, so that templates that can't be rendered are found at startup rather
+// than when the data arrives. Templates that use fields the sample doesn't have
+// are only warned about, not every sensor sends every field.
+func CheckTemplates(cfg cfg.Config) error {
+	if len(cfg.Templates) == 0 {
+		return nil
+	}
+
+	converter, err := units.New(cfg.Units, cfg.UnitOverrides, cfg.Precision)
+	if err != nil {
+		return err
+	}
+
+	topics, err := tp.New(cfg.TopicTemplate, cfg.BaseTopic, cfg.Site, cfg.TopicReplace)
+	if err != nil {
+		return err
+	}
+
+	/* Rendering only needs the units, the topics and the templates */
+	stn := station{
+		cfg:    cfg,
+		clock:  realClock{},
+		units:  converter,
+		topics: topics,
+	}
+
+	for _, name := range templateNames(cfg) {
+		tmpl, err := newTemplate(cfg, name)
+		if err != nil {
+			return err
+		}
+
+		stn.templates = append(stn.templates, tmpl)
+	}
+
+	sample := samplePacket()
+
+	_, key, err := stn.identify(sample)
+	if err != nil {
+		return err
+	}
+
+	normalizedData, quality, err := normalizeData(sample)
+	if err != nil {
+		return err
+	}
+
+	synthesizedData, err := synthesizeData(newSensorState(cfg, stn.clock), normalizedData)
+	if err != nil {
+		return err
+	}
+
+	values := stn.templateData(key, synthesizedData, quality)
+
+	for _, tmpl := range stn.templates {
+		d, err := stn.render(tmpl, key, sample, values)
+		if err != nil {
+			return err
+		}
+
+		strict, _ := tmpl.text.Clone()
+		if _, err := render.Execute(strict.Option("missingkey=error"), values); err != nil {
+			log.Warnf("template %s uses data the sample doesn't have, %v", tmpl.name, err)
+		}
+
+		log.Debugf("template %s publishes %q to %s", tmpl.name, d.Data, d.Topic)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package weather
+
+import (
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+	mh "github.com/geoff-coppertop/weather-sensor-bridge/internal/maphelper"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	TrendRising  = "rising"
+	TrendSteady  = "steady"
+	TrendFalling = "falling"
+
+	trendWindow = time.Hour
+
+	/* The trend isn't published until the samples cover this much of the
+	 * window, a line through a few minutes of data says very little */
+	trendMinSpan = 15 * time.Minute
+)
+
+// The fields that have a trend, and how fast (per hour) they have to change to
+// count as rising or falling
+var trendThresholds = map[string]float64{
+	"temp":     0.5,
+	"hum":      2,
+	"dewpoint": 0.5,
+}
+
+func newTrends(clock acc.Clock) map[string]*acc.Accumulator {
+	trends := make(map[string]*acc.Accumulator)
+
+	for field := range trendThresholds {
+		trends[field] = acc.New(trendWindow, clock, acc.ROLLING)
+	}
+
+	return trends
+}
+
+// synthesizeTrends adds the rate of change of each field over the last hour,
+// from a line fit through its samples, as <field>_trend_1h and classifies it as
+// <field>_trend
+func synthesizeTrends(state *sensorState, data map[string]interface{}) {
+	for field, threshold := range trendThresholds {
+		value, ok := mh.GetFloatValue(data, field)
+		if !ok {
+			continue
+		}
+
+		stats, err := state.trends[field].Accumulate(value)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		if stats.Span < trendMinSpan {
+			continue
+		}
+
+		slope := stats.Slope * time.Hour.Seconds()
+
+		data[field+"_trend_1h"] = slope
+		data[field+"_trend"] = classifyTrend(slope, threshold)
+	}
+}
+
+func classifyTrend(slope float64, threshold float64) string {
+	switch {
+	case slope >= threshold:
+		return TrendRising
+	case slope <= -threshold:
+		return TrendFalling
+	default:
+		return TrendSteady
+	}
+}
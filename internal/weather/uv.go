@@ -0,0 +1,60 @@
+package weather
+
+import (
+	"fmt"
+	gomath "math"
+
+	mh "github.com/geoff-coppertop/weather-sensor-bridge/internal/maphelper"
+)
+
+// uvRisk is a WHO UV index exposure category
+type uvRisk struct {
+	max    float64 // highest (rounded) index in the category
+	risk   string
+	colour string
+}
+
+// https://www.who.int/publications/i/item/9241590076
+var uvRisks = []uvRisk{
+	{2, "low", "#4EB400"},
+	{5, "moderate", "#F7E400"},
+	{7, "high", "#F85900"},
+	{10, "very_high", "#D8001D"},
+	{gomath.Inf(1), "extreme", "#6B49C8"},
+}
+
+// The minimal erythemal dose (J/m^2) of each Fitzpatrick skin type, I to VI,
+// the exposure that just reddens the skin
+var minimalErythemalDose = []float64{200, 250, 350, 450, 600, 1000}
+
+/* Each step of the UV index is 25mW/m^2 of erythemally weighted radiation */
+const uvIndexIrradiance = 0.025
+
+// synthesizeUV describes the UV index, its WHO risk category and colour, and
+// the minutes until unprotected skin of each Fitzpatrick type burns
+func synthesizeUV(data map[string]interface{}) {
+	uValue, uOk := mh.GetFloatValue(data, "uv")
+	if !uOk {
+		return
+	}
+
+	/* The categories are for whole numbers */
+	rounded := gomath.Round(uValue)
+	for _, r := range uvRisks {
+		if rounded <= r.max {
+			data["uv_risk"] = r.risk
+			data["uv_colour"] = r.colour
+			break
+		}
+	}
+
+	/* Nothing burns without any UV */
+	if uValue <= 0 {
+		return
+	}
+
+	for i, med := range minimalErythemalDose {
+		minutes := med / (uValue * uvIndexIrradiance) / 60
+		data[fmt.Sprintf("uv_burn_%d", i+1)] = minutes
+	}
+}
@@ -2,23 +2,36 @@ package weather
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	gomath "math"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/alert"
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/deadband"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/encoder"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/filter"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/flatline"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/irrigation"
 	mh "github.com/geoff-coppertop/weather-sensor-bridge/internal/maphelper"
-	"github.com/geoff-coppertop/weather-sensor-bridge/internal/math"
 	"github.com/geoff-coppertop/weather-sensor-bridge/internal/mqtt"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/payload"
+	psy "github.com/geoff-coppertop/weather-sensor-bridge/internal/psychrometrics"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/rain"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/records"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/summary"
+	tp "github.com/geoff-coppertop/weather-sensor-bridge/internal/topic"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/units"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/wind"
 	"github.com/martinlindhe/unit"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
-	BaseTopic = "sensor/rtl_433"
-
 	TemperatureError        = 0x0FFF
 	TemperatureInvalid      = 0x07FA
 	TemperatureBelowMinimum = 0x07FC
@@ -31,6 +44,39 @@ const (
 	UVIndexInvalid  = 0xFA
 )
 
+// Reasons a field was left out of the data, published in the quality object
+const (
+	QualitySensorError  = "sensor_error"  // the sensor reported a fault
+	QualityInvalid      = "invalid"       // the sensor reported that the reading is invalid
+	QualityBelowMinimum = "below_minimum" // the reading is below what the sensor can measure
+	QualityAboveMaximum = "above_maximum" // the reading is above what the sensor can measure
+	QualityOutOfRange   = "out_of_range"  // the reading is outside of the sensor's range without a sentinel
+	QualityRejected     = "rejected"      // the reading failed filtering
+)
+
+// The values the sensor sends in place of a reading, and what they mean
+var (
+	temperatureSentinels = map[int]string{
+		TemperatureError:        QualitySensorError,
+		TemperatureInvalid:      QualityInvalid,
+		TemperatureBelowMinimum: QualityBelowMinimum,
+		TemperatureAboveMaximum: QualityAboveMaximum,
+	}
+
+	humiditySentinels = map[int]string{
+		HumidityError:   QualitySensorError,
+		HumidityInvalid: QualityInvalid,
+	}
+
+	sunlightSentinels = map[int]string{
+		SunlightInvalid: QualityInvalid,
+	}
+
+	uvIndexSentinels = map[int]string{
+		UVIndexInvalid: QualityInvalid,
+	}
+)
+
 type dataSynth func(data acc.Stats) float64
 
 type synthesizer struct {
@@ -39,25 +85,64 @@ type synthesizer struct {
 	dataFunc dataSynth
 }
 
+// sensorState holds everything we accumulate for a single sensor
+type sensorState struct {
+	key       string // the sensor's model/channel/id
+	synthMap  map[string][]synthesizer
+	rain      *rain.Tracker
+	filter    *filter.Filter
+	flatline  *flatline.Detector
+	wdir      *wind.Direction
+	gust10m   *wind.Gust
+	gust24hr  *wind.Gust
+	windRun   *wind.Run
+	records   *records.Tracker
+	summary   *summary.Tracker
+	trends    map[string]*acc.Accumulator
+	solar     *solarState
+	et0       *et0State
+	zones     map[string]*irrigation.Balance
+	degDays   *degreeDayState
+	fields    map[string]publishedField
+	discovery *discoveryState
+	node      *homieNode
+	reporter  *deadband.Reporter
+}
+
+// station is the collection of sensors we have heard from
+type station struct {
+	cfg       cfg.Config
+	clock     acc.Clock
+	sensors   map[string]*sensorState
+	alerts    *alert.Engine
+	units     *units.Converter
+	topics    *tp.Template
+	device    *homieDevice
+	templates []payloadTemplate
+	encoder   encoder.Encoder
+}
+
 type realClock struct{}
 
 func (realClock) Now() time.Time { return time.Now() }
 
-func Start(ctx context.Context, wg *sync.WaitGroup, in <-chan map[string]interface{}) <-chan mqtt.Data {
+// checkPeriod is how often sensors are checked for having gone offline
+const checkPeriod = time.Minute
+
+// Start handles the sensor data from in. The weather data is sent on the first
+// channel returned, the alerts that are raised or cleared on the second.
+func Start(ctx context.Context, wg *sync.WaitGroup, cfg cfg.Config, in <-chan map[string]interface{}) (<-chan mqtt.Data, <-chan alert.Alert) {
 	out := make(chan mqtt.Data)
+	alerts := make(chan alert.Alert, 16)
 
 	wg.Add(1)
 
-	synthMap := map[string][]synthesizer{
-		"wspd": {synthesizer{"wspd_2m", acc.New(2*time.Minute, realClock{}, acc.ROLLING), getAverage}},
-		"rain_acc": {
-			synthesizer{"rain_1hr", acc.New(1*time.Hour, realClock{}, acc.ROLLING), getPeriodDelta},
-			synthesizer{"rain_24hr", acc.New(24*time.Hour, realClock{}, acc.CONSECUTIVE), getPeriodDelta},
-		},
-		"wdir": {synthesizer{"wdir", acc.New(2*time.Minute, realClock{}, acc.ROLLING), getAverage}},
-	}
+	stn := newStation(cfg, realClock{})
 
 	go func() {
+		dayEnd := time.NewTimer(time.Until(stn.nextDayEnd()))
+		check := time.NewTicker(checkPeriod)
+
 		for {
 			select {
 			case data, ok := <-in:
@@ -65,80 +150,388 @@ func Start(ctx context.Context, wg *sync.WaitGroup, in <-chan map[string]interfa
 					continue
 				}
 
-				wxData, err := handleData(synthMap, data)
+				wxData, raised, err := stn.handleData(data)
 				if err != nil {
 					continue
 				}
 
-				out <- wxData
+				for _, d := range wxData {
+					out <- d
+				}
+
+				notify(alerts, raised)
+
+			case <-check.C:
+				raised := stn.alerts.Check()
+
+				for _, d := range stn.buildAlerts(raised) {
+					out <- d
+				}
+
+				if cfg.HADiscovery {
+					for _, d := range stn.checkDiscovery() {
+						out <- d
+					}
+				}
+
+				notify(alerts, raised)
+
+			case <-dayEnd.C:
+				for _, d := range stn.endOfDay() {
+					out <- d
+				}
+
+				dayEnd.Reset(time.Until(stn.nextDayEnd()))
 
 			case <-ctx.Done():
+				dayEnd.Stop()
+				check.Stop()
 				close(out)
+				close(alerts)
 				wg.Done()
 				return
 			}
 		}
 	}()
 
-	return out
+	return out, alerts
 }
 
-func handleData(synthMap map[string][]synthesizer, data map[string]interface{}) (mqtt.Data, error) {
-	log.Debug(data)
+// notify passes alerts on to be delivered without waiting, a slow mail server
+// mustn't hold up the weather data
+func notify(out chan<- alert.Alert, alerts []alert.Alert) {
+	for _, a := range alerts {
+		select {
+		case out <- a:
+		default:
+			log.Warnf("dropped alert, too many waiting: %s", a.Message)
+		}
+	}
+}
 
-	topic, err := buildTopicString(data)
+func newStation(cfg cfg.Config, clock acc.Clock) *station {
+	converter, err := units.New(cfg.Units, cfg.UnitOverrides, cfg.Precision)
 	if err != nil {
-		return mqtt.Data{}, err
+		log.Errorf("%v, publishing in metric", err)
+		converter, _ = units.New(units.Metric, nil, cfg.Precision)
 	}
 
-	normalizedData, err := normalizeData(data)
+	topics, err := tp.New(cfg.TopicTemplate, cfg.BaseTopic, cfg.Site, cfg.TopicReplace)
 	if err != nil {
-		return mqtt.Data{}, err
+		log.Errorf("%v, publishing to the default topics", err)
+		topics, _ = tp.New(tp.DefaultTemplate, tp.DefaultBase, "", tp.DefaultReplacements)
 	}
 
-	synthesizedData, err := synthesizeData(synthMap, normalizedData)
+	enc, err := encoder.New(cfg.Encoding)
 	if err != nil {
-		return mqtt.Data{}, err
+		log.Errorf("%v, publishing in JSON", err)
+		enc, _ = encoder.New(encoder.JSON)
+	}
+
+	stn := station{
+		cfg:       cfg,
+		clock:     clock,
+		sensors:   make(map[string]*sensorState),
+		alerts:    alert.New(cfg.AlertRules, clock),
+		units:     converter,
+		topics:    topics,
+		device:    newHomieDevice(),
+		templates: newTemplates(cfg),
+		encoder:   enc,
+	}
+
+	return &stn
+}
+
+// convert returns a copy of data in the units and precision it is published
+// in, with the units of its fields added. Everything is worked out in metric,
+// so this is the last thing done before publishing.
+func (stn *station) convert(data map[string]interface{}) map[string]interface{} {
+	converted, fieldUnits := stn.units.Convert(data)
+
+	if len(fieldUnits) > 0 {
+		converted["units"] = fieldUnits
+	}
+
+	return converted
+}
+
+// sensor returns the state for the sensor publishing on topic, creating it the
+// first time the sensor is heard from
+func (stn *station) sensor(topic string, key string) *sensorState {
+	state, ok := stn.sensors[topic]
+	if !ok {
+		state = newSensorState(stn.cfg, stn.clock)
+		state.key = key
+		stn.sensors[topic] = state
 	}
 
-	txData, err := json.Marshal(synthesizedData)
+	return state
+}
+
+// nextDayEnd is when the current day's summaries are due. It is a moment after
+// the day ends so that the new day has started by the time we get there.
+func (stn *station) nextDayEnd() time.Time {
+	start := summary.DayStart(stn.clock.Now(), stn.cfg.Location, stn.cfg.DayBoundary)
+
+	return start.AddDate(0, 0, 1).Add(time.Second)
+}
+
+// endOfDay closes the day that has just ended for every sensor, along with its
+// irrigation zones, and the month if that was its last day. The summaries are
+// retained so that they are available until the next ones replace them.
+func (stn *station) endOfDay() []mqtt.Data {
+	today := summary.DayStart(stn.clock.Now(), stn.cfg.Location, stn.cfg.DayBoundary)
+	yesterday := today.AddDate(0, 0, -1)
+	monthEnded := today.Month() != yesterday.Month()
+
+	var wxData []mqtt.Data
+
+	for topic, state := range stn.sensors {
+		if daily, ok := state.summary.CloseDay(yesterday); ok {
+			state.et0.closeDay(yesterday, daily)
+
+			if d, err := stn.buildSummary(mqtt.JoinTopic(topic, "summary", "daily"), daily); err == nil {
+				wxData = append(wxData, d)
+			}
+
+			wxData = append(wxData, stn.irrigate(topic, state, yesterday, daily)...)
+		}
+
+		if !monthEnded {
+			continue
+		}
+
+		if monthly, ok := state.summary.CloseMonth(yesterday); ok {
+			if d, err := stn.buildSummary(mqtt.JoinTopic(topic, "summary", "monthly"), monthly); err == nil {
+				wxData = append(wxData, d)
+			}
+		}
+	}
+
+	return wxData
+}
+
+func (stn *station) buildSummary(topic string, data map[string]interface{}) (mqtt.Data, error) {
+	txData, err := stn.encoder.Encode(stn.convert(data))
 	if err != nil {
+		log.Error(err)
 		return mqtt.Data{}, err
-
 	}
 
 	return mqtt.Data{
-		Topic: topic,
-		Data:  txData,
+		Topic:       topic,
+		Data:        txData,
+		Retain:      true,
+		ContentType: stn.encoder.ContentType(),
 	}, nil
 }
 
-func buildTopicString(data map[string]interface{}) (string, error) {
-	var err error
-	topic := BaseTopic
+// The daily high/low records that are kept
+var recordFields = map[string]records.Kind{
+	"temp":      records.HIGH_LOW,
+	"hum":       records.HIGH_LOW,
+	"wspd_gust": records.HIGH,
+	"uv":        records.HIGH,
+	"solar":     records.HIGH,
+}
+
+func newSensorState(cfg cfg.Config, clock acc.Clock) *sensorState {
+	/* Anything "today" runs from the configured start of the local day */
+	newDay := func() *acc.Accumulator {
+		return acc.New(24*time.Hour, clock, acc.CONSECUTIVE).Align(cfg.Location, cfg.DayBoundary)
+	}
+
+	degDays := newDegreeDayState(cfg, clock, newDay)
+
+	state := sensorState{
+		synthMap: map[string][]synthesizer{
+			"wspd": {synthesizer{"wspd_2m", acc.New(2*time.Minute, clock, acc.ROLLING), getAverage}},
+			"rain_acc": {
+				synthesizer{"rain_1hr", acc.New(1*time.Hour, clock, acc.ROLLING), getIncrease},
+				synthesizer{"rain_24hr", newDay(), getIncrease},
+			},
+			"rain_rate": {
+				synthesizer{"rain_rate_1hr_max", acc.New(1*time.Hour, clock, acc.ROLLING), getMaximum},
+				synthesizer{"rain_rate_24hr_max", newDay(), getMaximum},
+			},
+		},
+		filter:    filter.New(filter.MergeLimits(defaultLimits, cfg.FilterLimits), cfg.FilterWindow, clock),
+		flatline:  flatline.New(flatlineRules(cfg.FlatlineTol), cfg.FlatlineTime, cfg.StuckTime, clock),
+		rain:      rain.New(cfg.RainEventDryTime, clock),
+		wdir:      wind.NewDirection(acc.New(2*time.Minute, clock, acc.ROLLING), acc.New(2*time.Minute, clock, acc.ROLLING)),
+		gust10m:   wind.NewGust(acc.New(10*time.Minute, clock, acc.ROLLING)),
+		gust24hr:  wind.NewGust(newDay()),
+		windRun:   wind.NewRun(newDay()),
+		records:   records.New(recordFields, newDay),
+		summary:   summary.New(newDay, degDays.tracker),
+		trends:    newTrends(clock),
+		solar:     newSolarState(cfg, clock, newDay),
+		et0:       newET0State(cfg, clock, newDay),
+		zones:     make(map[string]*irrigation.Balance),
+		degDays:   degDays,
+		fields:    make(map[string]publishedField),
+		discovery: newDiscoveryState(),
+		node:      newHomieNode(),
+		reporter:  deadband.New(cfg.Deadbands, cfg.Heartbeat, clock),
+	}
+
+	return &state
+}
+
+func (stn *station) handleData(data map[string]interface{}) ([]mqtt.Data, []alert.Alert, error) {
+	log.Debug(data)
+
+	topic, key, err := stn.identify(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	normalizedData, quality, err := normalizeData(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	state := stn.sensor(topic, key)
+	var wxData []mqtt.Data
+
+	calibrateData(stn.cfg, key, normalizedData)
+
+	rejected := filterData(state, normalizedData)
+	for _, field := range rejected {
+		quality[field] = QualityRejected
+	}
+
+	flagsChanged := state.flatline.Update(normalizedData)
+
+	if (len(rejected) > 0) || flagsChanged {
+		diagData, err := stn.buildDiagnostics(topic, state)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		wxData = append(wxData, diagData)
+	}
+
+	/* With deadbands the sensor's data is only published when its readings
+	 * have changed by enough, or for the heartbeat. The readings are compared
+	 * in the units they are published in, before anything is synthesized
+	 * from them. */
+	report := true
+	if len(stn.cfg.Deadbands) > 0 {
+		readings, _ := stn.units.Convert(normalizedData)
+		report = state.reporter.Report(readings)
+	}
+
+	synthesizedData, err := synthesizeData(state, normalizedData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if report && (stn.cfg.FieldTopics != payload.FieldTopicsOnly) && !stn.cfg.TemplatesOnly {
+		txData, err := stn.buildPayload(key, data, synthesizedData, quality, flaggedFields(state, synthesizedData))
+		if err != nil {
+			return nil, nil, err
+
+		}
+
+		wxData = append(wxData, mqtt.Data{
+			Topic:       topic,
+			Data:        txData,
+			ContentType: stn.encoder.ContentType(),
+		})
+	}
+
+	if report && ((stn.cfg.FieldTopics == payload.FieldTopicsAlso) || (stn.cfg.FieldTopics == payload.FieldTopicsOnly)) {
+		wxData = append(wxData, stn.buildFields(topic, state, synthesizedData)...)
+	}
+
+	if report && (len(stn.templates) > 0) {
+		wxData = append(wxData, stn.buildTemplates(key, data, synthesizedData, quality)...)
+	}
+
+	if stn.cfg.HADiscovery {
+		wxData = append(wxData, stn.discover(topic, state, data, synthesizedData)...)
+	}
+
+	if report && stn.cfg.Homie {
+		wxData = append(wxData, stn.describe(state, data, synthesizedData)...)
+	}
+
+	/* Alerts can be on anything, including the synthetic data, and are
+	 * always in metric */
+	raised := stn.alerts.Update(key, synthesizedData)
+	wxData = append(wxData, stn.buildAlerts(raised)...)
+
+	return wxData, raised, nil
+}
+
+// identify returns the topic the sensor that sent data publishes on, and the
+// sensor's key, its sanitized model/channel/id. The key is what per-sensor
+// configuration is keyed on, whatever the topic template.
+func (stn *station) identify(data map[string]interface{}) (string, string, error) {
+	sensor := stn.identity(data)
+
+	key := tp.Join(stn.topics.Sanitize(sensor[tp.Model]), stn.topics.Sanitize(sensor[tp.Channel]), stn.topics.Sanitize(sensor[tp.ID]))
+	if len(key) == 0 {
+		return "", "", fmt.Errorf("data has no topic information")
+	}
+
+	sensor[tp.Alias] = stn.cfg.SensorAliases[key]
 
-	if val, ok := mh.GetStringValue(data, "model"); ok {
-		topic = mqtt.JoinTopic(topic, val)
+	topic, err := stn.topics.Execute(sensor)
+	if err != nil {
+		return "", "", err
 	}
 
-	if val, ok := mh.GetStringValue(data, "channel"); ok {
-		topic = mqtt.JoinTopic(topic, val)
+	return topic, key, nil
+}
+
+// identity returns the model, channel and id of the sensor that sent data, as
+// they are given to topic templates. Numbers have six decimals, as they always
+// have in topics, unless TOPIC_PLAIN_NUMBERS is set.
+func (stn *station) identity(data map[string]interface{}) map[string]string {
+	value := legacyIdentifier
+	if stn.cfg.TopicNumbers {
+		value = identifier
 	}
 
-	if val, ok := mh.GetStringValue(data, "id"); ok {
-		topic = mqtt.JoinTopic(topic, val)
+	return map[string]string{
+		tp.Model:   value(data, "model"),
+		tp.Channel: value(data, "channel"),
+		tp.ID:      value(data, "id"),
 	}
+}
+
+// legacyIdentifier returns the part of the sensor's identity at key the way
+// topics were first built, numbers are written with six decimals
+func legacyIdentifier(data map[string]interface{}, key string) string {
+	val, _ := mh.GetStringValue(data, key)
+	return val
+}
 
-	if topic == BaseTopic {
-		err = fmt.Errorf("data has no topic information")
+// identifier returns the part of the sensor's identity at key, numbers are
+// written without any decimals they don't need
+func identifier(data map[string]interface{}, key string) string {
+	switch val := data[key].(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(val)
 	}
 
-	return topic, err
+	return ""
 }
 
-func normalizeData(data map[string]interface{}) (map[string]interface{}, error) {
+// normalizeData converts the sensor data into our fields and units. Fields that
+// the sensor sent without a usable reading are left out and the reason is
+// returned in the quality map.
+func normalizeData(data map[string]interface{}) (map[string]interface{}, map[string]string, error) {
 	// https://www.switchdoc.com/wp-content/uploads/2021/04/WeatherRack2Installation1.3.pdf - page 20
 	normalizedData := make(map[string]interface{})
+	quality := make(map[string]string)
 
 	// Battery
 	if val, ok := mh.GetBoolValue(data, "batterylow"); ok {
@@ -148,11 +541,11 @@ func normalizeData(data map[string]interface{}) (map[string]interface{}, error)
 	// Wind
 	if val, ok := mh.GetFloatValue(data, "avewindspeed"); ok {
 		// 0+, needs to be in m/s
-		normalizedData["wspd"] = math.Round(val/10, 2)
+		normalizedData["wspd"] = val / 10
 	}
 	if val, ok := mh.GetFloatValue(data, "gustwindspeed"); ok {
 		// 0+, needs to be in m/s
-		normalizedData["wspd_gust"] = math.Round(val/10, 2)
+		normalizedData["wspd_gust"] = val / 10
 	}
 	if val, ok := mh.GetIntValue(data, "winddirection"); ok {
 		// 0 - 359, needs to be in degrees
@@ -163,79 +556,92 @@ func normalizeData(data map[string]interface{}) (map[string]interface{}, error)
 	// Rain
 	if val, ok := mh.GetFloatValue(data, "cumulativerain"); ok {
 		// 0+, needs to be in mm
-		normalizedData["rain_acc"] = math.Round(val/10, 2)
+		normalizedData["rain_acc"] = val / 10
 	}
 
 	// Temperature
 	if val, ok := mh.GetIntValue(data, "temperature"); ok {
 		// Needs to be in C, because we aren't heathens
-		switch val {
-		case TemperatureError:
-		case TemperatureInvalid:
-		case TemperatureAboveMaximum:
-		case TemperatureBelowMinimum:
-			break
-
-		default:
-			normalizedData["temp"] = math.Round(unit.FromFahrenheit(float64(val-400)/10).Celsius(), 2)
-
-			// dewpoint =  state.OutdoorTemperature - ((100.0 - state.OutdoorHumidity) / 5.0);
+		if reason, isSentinel := temperatureSentinels[val]; isSentinel {
+			quality["temp"] = reason
+		} else {
+			normalizedData["temp"] = unit.FromFahrenheit(float64(val-400) / 10).Celsius()
 		}
 	}
 	if val, ok := mh.GetIntValue(data, "humidity"); ok {
 		// 0 - 100%
-		switch val {
-		case HumidityError:
-		case HumidityInvalid:
-			break
-
-		default:
+		if reason, isSentinel := humiditySentinels[val]; isSentinel {
+			quality["hum"] = reason
+		} else {
 			normalizedData["hum"] = val
-			break
 		}
 	}
 
 	// Sun
 	if val, ok := mh.GetIntValue(data, "light"); ok {
 		// 0 - 200k lux
-		if (val >= 0) && (val < SunlightInvalid) {
+		if reason, isSentinel := sunlightSentinels[val]; isSentinel {
+			quality["light"] = reason
+		} else if (val < 0) || (val > SunlightInvalid) {
+			quality["light"] = QualityOutOfRange
+		} else {
 			normalizedData["light"] = val
 		}
 	}
-	if val, ok := mh.GetFloatValue(data, "uv"); ok {
+	if val, ok := mh.GetIntValue(data, "uv"); ok {
 		// 0+?, it's a unitless quantity
-		if (val >= 0) && (val < UVIndexInvalid) {
-			normalizedData["uv"] = math.Round(val/10, 2)
+		if reason, isSentinel := uvIndexSentinels[val]; isSentinel {
+			quality["uv"] = reason
+		} else if (val < 0) || (val > UVIndexInvalid) {
+			quality["uv"] = QualityOutOfRange
+		} else {
+			normalizedData["uv"] = float64(val) / 10
 		}
 	}
 
-	if len(normalizedData) == 0 {
-		return normalizedData, fmt.Errorf("no data to normalize from input: %v", data)
+	if (len(normalizedData) == 0) && (len(quality) == 0) {
+		return normalizedData, quality, fmt.Errorf("no data to normalize from input: %v", data)
 	}
 
-	return normalizedData, nil
+	return normalizedData, quality, nil
 }
 
-func synthesizeData(synthMap map[string][]synthesizer, data map[string]interface{}) (map[string]interface{}, error) {
-	/* Generate dewpoint since it requires two fields of data */
-	hValue, hOk := mh.GetFloatValue(data, "hum")
-	tValue, tOk := mh.GetFloatValue(data, "temp")
-	if tOk && hOk {
-		data["dewpoint"] = math.Round(tValue-((100.0-hValue)/5.0), 2)
-	}
+func synthesizeData(state *sensorState, data map[string]interface{}) (map[string]interface{}, error) {
+	synthesizePsychrometrics(data)
+	synthesizeTrends(state, data)
+	synthesizeDegreeDays(state.degDays, data)
 
 	/* Solar radiation is a function of incident light, it's a little bit black magic
 	 * https://help.ambientweather.net/help/why-is-the-lux-to-w-m-2-conversion-factor-126-7 */
 	if sValue, sOk := mh.GetFloatValue(data, "light"); sOk {
-		data["solar"] = math.Round(sValue/126.7, 2)
+		data["solar"] = sValue / 126.7
 	}
 
-	if wValue, wOk := mh.GetFloatValue(data, "wdir"); wOk {
-		data["wdir_gust"] = wValue
+	synthesizeUV(data)
+	synthesizeSolar(state.solar, data)
+	synthesizeET0(state.et0, data)
+
+	/* Rain rate and events come from the time between tips of the gauge */
+	if rValue, rOk := mh.GetFloatValue(data, "rain_acc"); rOk {
+		status := state.rain.Update(rValue)
+
+		data["rain_rate"] = status.Rate
+
+		if status.HasEvent {
+			data["rain_event"] = status.EventActive
+			data["rain_event_start"] = status.EventStart.Format(time.RFC3339)
+			data["rain_event_dur"] = status.EventDuration.Minutes()
+			data["rain_event_acc"] = status.EventTotal
+		}
 	}
 
+	synthesizeWind(state, data)
+
+	/* The summaries want the instantaneous direction, before it is averaged */
+	state.summary.Update(data)
+
 	/* Generate statistical data */
-	for key, synths := range synthMap {
+	for key, synths := range state.synthMap {
 		key = strings.ToLower(key)
 
 		dataValue, ok := mh.GetFloatValue(data, key)
@@ -255,17 +661,147 @@ func synthesizeData(synthMap map[string][]synthesizer, data map[string]interface
 
 			log.Debugf("%s: %.2f", synth.outKey, outValue)
 
-			data[synth.outKey] = math.Round(outValue, 2)
+			data[synth.outKey] = outValue
+		}
+	}
+
+	/* Directions are averaged as vectors */
+	if dValue, dOk := mh.GetFloatValue(data, "wdir"); dOk {
+		mean, ok, err := state.wdir.Update(dValue)
+		if err != nil {
+			log.Error(err)
+		} else if ok {
+			data["wdir"] = gomath.Mod(mean, 360)
 		}
 	}
 
+	/* Describe the averaged wind, which is only available once the statistics
+	 * have been generated */
+	if wValue, wOk := mh.GetFloatValue(data, "wspd_2m"); wOk {
+		data["beaufort"], data["beaufort_desc"] = wind.Beaufort(wValue)
+	}
+
+	if dValue, dOk := mh.GetFloatValue(data, "wdir"); dOk {
+		data["wdir_cardinal"] = wind.Cardinal(dValue)
+	}
+
+	today, yesterday := state.records.Update(data)
+	data["records"] = map[string]interface{}{
+		"today":     today,
+		"yesterday": yesterday,
+	}
+
 	return data, nil
 }
 
+// synthesizeWind adds the strongest gusts, with the direction they came from,
+// and the wind run for the day
+func synthesizeWind(state *sensorState, data map[string]interface{}) {
+	dValue, dOk := mh.GetFloatValue(data, "wdir")
+	if !dOk {
+		dValue = gomath.NaN()
+	}
+
+	if gValue, gOk := mh.GetFloatValue(data, "wspd_gust"); gOk {
+		gusts := []struct {
+			gust     *wind.Gust
+			speedKey string
+			dirKey   string
+		}{
+			{state.gust10m, "wspd_gust_10m", "wdir_gust_10m"},
+			{state.gust24hr, "wspd_gust_24hr", "wdir_gust_24hr"},
+		}
+
+		for _, g := range gusts {
+			speed, dir, ok, err := g.gust.Update(gValue, dValue)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+
+			data[g.speedKey] = speed
+
+			if ok {
+				data[g.dirKey] = dir
+			}
+		}
+	}
+
+	if wValue, wOk := mh.GetFloatValue(data, "wspd"); wOk {
+		run, err := state.windRun.Update(wValue)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
+		data["wind_run_24hr"] = run
+	}
+}
+
+// synthesizePsychrometrics adds the fields that need temperature together with
+// humidity and/or wind speed from the same packet. Each is only added when the
+// inputs are within the range its formula is good for.
+func synthesizePsychrometrics(data map[string]interface{}) {
+	tValue, tOk := mh.GetFloatValue(data, "temp")
+	if !tOk {
+		return
+	}
+
+	wValue, wOk := mh.GetFloatValue(data, "wspd")
+
+	if wOk {
+		if wc, ok := psy.WindChill(tValue, wValue); ok {
+			data["wind_chill"] = wc
+		}
+	}
+
+	hValue, hOk := mh.GetFloatValue(data, "hum")
+	if !hOk {
+		return
+	}
+
+	dewpoint, dOk := psy.DewPoint(tValue, hValue)
+	if dOk {
+		data["dewpoint"] = dewpoint
+
+		if hx, ok := psy.Humidex(tValue, dewpoint); ok {
+			data["humidex"] = hx
+		}
+	}
+
+	if hi, ok := psy.HeatIndex(tValue, hValue); ok {
+		data["heat_index"] = hi
+	}
+
+	if wOk {
+		if at, ok := psy.ApparentTemperature(tValue, hValue, wValue); ok {
+			data["apparent_temp"] = at
+		}
+	}
+
+	if tw, ok := psy.WetBulb(tValue, hValue); ok {
+		data["wetbulb"] = tw
+	}
+
+	if e, ok := psy.VapourPressure(tValue, hValue); ok {
+		data["vapour_pressure"] = e
+	}
+
+	if ah, ok := psy.AbsoluteHumidity(tValue, hValue); ok {
+		data["abs_hum"] = ah
+	}
+
+	data["feels_like"] = psy.FeelsLike(tValue, hValue, wValue, wOk)
+}
+
 func getAverage(s acc.Stats) float64 {
 	return s.Average
 }
 
-func getPeriodDelta(s acc.Stats) float64 {
-	return s.PeriodDelta
+func getIncrease(s acc.Stats) float64 {
+	return s.Increase
+}
+
+func getMaximum(s acc.Stats) float64 {
+	return s.Maximum
 }
@@ -3,7 +3,26 @@ package weather
 import (
 	"encoding/json"
 	"io/ioutil"
+	gomath "math"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/alert"
+	cfg "github.com/geoff-coppertop/weather-sensor-bridge/internal/config"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/deadband"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/encoder"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/et0"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/flatline"
+	ha "github.com/geoff-coppertop/weather-sensor-bridge/internal/homeassistant"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/homie"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/irrigation"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/mqtt"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/payload"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/render"
+	tp "github.com/geoff-coppertop/weather-sensor-bridge/internal/topic"
+	"github.com/geoff-coppertop/weather-sensor-bridge/internal/units"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 type TestData struct {
@@ -12,6 +31,43 @@ type TestData struct {
 	Output map[string]interface{} `json:"output"`
 }
 
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+// testConfig is the configuration with all of the optional settings left at
+// their defaults
+func testConfig() cfg.Config {
+	return cfg.Config{
+		RainEventDryTime: 6 * time.Hour,
+		FilterWindow:     10 * time.Minute,
+		FlatlineTime:     6 * time.Hour,
+		StuckTime:        time.Hour,
+		Location:         time.UTC,
+		GDDBase:          10,
+		GDDCap:           30,
+		SeasonMonth:      time.January,
+		SeasonDay:        1,
+		Units:            units.Metric,
+		PayloadFormat:    payload.Flat,
+		Encoding:         encoder.JSON,
+		FieldTopics:      payload.FieldTopicsOff,
+		FieldRetain:      map[string]bool{AnyField: true},
+		FieldRefresh:     15 * time.Minute,
+		Heartbeat:        15 * time.Minute,
+		BaseTopic:        tp.DefaultBase,
+		TopicTemplate:    tp.DefaultTemplate,
+		TopicReplace:     tp.DefaultReplacements,
+		HAPrefix:         ha.DefaultPrefix,
+		HAOfflineTime:    15 * time.Minute,
+		HARemoveTime:     24 * time.Hour,
+		HomiePrefix:      homie.DefaultPrefix,
+		HomieDeviceID:    homie.DefaultDeviceID,
+	}
+}
+
 func getTestData(path string) (TestData, error) {
 	file, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -27,25 +83,90 @@ func getTestData(path string) (TestData, error) {
 	return data, nil
 }
 
-func TestBuildTopicStringEmptyMap(t *testing.T) {
-	if _, err := buildTopicString(make(map[string]interface{})); err == nil {
+/* test.json's topic leaves out the sensor's id, 0, which the default template
+ * adds with six decimals */
+func sensorTopic(test TestData) string {
+	return mqtt.JoinTopic(test.Topic, "0_000000")
+}
+
+/* near returns whether val is expected, numbers are worked out to full
+ * precision so only the decimals that are published have to match */
+func near(val interface{}, expected interface{}) bool {
+	v, vOk := val.(float64)
+	e, eOk := expected.(float64)
+	if vOk && eOk {
+		return gomath.Abs(v-e) < 0.005
+	}
+
+	return val == expected
+}
+
+func TestIdentifyEmptyMap(t *testing.T) {
+	stn := newStation(testConfig(), &testClock{})
+
+	if _, _, err := stn.identify(make(map[string]interface{})); err == nil {
 		t.Errorf("expected error")
 	}
 }
 
-func TestBuildTopicStringTestInput(t *testing.T) {
+func TestIdentifyTestInput(t *testing.T) {
 	test, err := getTestData("test.json")
 	if err != nil {
 		t.Error("failed to load test data")
 	}
 
-	if _, err := buildTopicString(test.Input); err != nil {
+	stn := newStation(testConfig(), &testClock{})
+
+	topic, key, err := stn.identify(test.Input)
+	if err != nil {
 		t.Errorf("unexpected error, err: %s", err)
 	}
+
+	if topic != sensorTopic(test) || key != "SwitchDoc_Labs_FT020T_AIO/0_000000" {
+		t.Errorf("unexpected topic %s for %s", topic, key)
+	}
+}
+
+func TestIdentifyTemplate(t *testing.T) {
+	var tests = []struct {
+		template string
+		plain    bool
+		aliases  map[string]string
+		input    map[string]interface{}
+		topic    string
+	}{
+		{"{base}/{model}/{channel}/{id}", true, nil, map[string]interface{}{"model": "Acme 1.0", "channel": "A", "id": 12.0}, "sensor/rtl_433/Acme_1_0/A/12"},
+		{"{base}/{model}/{channel}/{id}", true, nil, map[string]interface{}{"model": "Acme", "id": 12.0}, "sensor/rtl_433/Acme/12"},
+		{"weather/{site}/{alias|model}/{id}", true, nil, map[string]interface{}{"model": "Acme", "id": 12.0}, "weather/home/Acme/12"},
+		{"weather/{site}/{alias|model}/{id}", true, map[string]string{"Acme/12": "back garden"}, map[string]interface{}{"model": "Acme", "id": 12.0}, "weather/home/back_garden/12"},
+		/* Numbers are written with six decimals, as they always have been,
+		 * unless they are to be written as they were sent */
+		{"{base}/{model}/{channel}/{id}", false, nil, map[string]interface{}{"model": "Acme", "channel": 1.0, "id": 0.0}, "sensor/rtl_433/Acme/1_000000/0_000000"},
+		{"{base}/{model}/{channel}/{id}", false, nil, map[string]interface{}{"model": "Acme", "channel": "A", "id": "12"}, "sensor/rtl_433/Acme/A/12"},
+		{"weather/{alias|model}/{id}", false, map[string]string{"Acme/12_000000": "garden"}, map[string]interface{}{"model": "Acme", "id": 12.0}, "weather/garden/12_000000"},
+		{"{base}/{model}/{channel}/{id}", true, nil, map[string]interface{}{"model": "Acme", "channel": 1.0, "id": 0.0}, "sensor/rtl_433/Acme/1/0"},
+		{"{base}/{model}/{id}", true, nil, map[string]interface{}{"model": "Acme", "id": 1.5}, "sensor/rtl_433/Acme/1_5"},
+		/* Sensors can't add levels or wildcards */
+		{"{base}/{model}", false, nil, map[string]interface{}{"model": "a/b+c#"}, "sensor/rtl_433/a_b_c_"},
+	}
+
+	for _, test := range tests {
+		config := testConfig()
+		config.Site = "home"
+		config.TopicTemplate = test.template
+		config.TopicNumbers = test.plain
+		config.SensorAliases = test.aliases
+
+		stn := newStation(config, &testClock{})
+
+		if topic, _, err := stn.identify(test.input); err != nil || topic != test.topic {
+			t.Errorf("%s %v: expected %s, got %s (%v)", test.template, test.input, test.topic, topic, err)
+		}
+	}
 }
 
 func TestNormalizeDataEmptyMap(t *testing.T) {
-	if _, err := normalizeData(make(map[string]interface{})); err == nil {
+	if _, _, err := normalizeData(make(map[string]interface{})); err == nil {
 		t.Errorf("expected error")
 	}
 }
@@ -56,11 +177,18 @@ func TestNormalizeDataTestInput(t *testing.T) {
 		t.Errorf("failed to load test data")
 	}
 
-	data, err := normalizeData(test.Input)
+	data, quality, err := normalizeData(test.Input)
 	if err != nil {
 		t.Errorf("failed to normalize test data")
 	}
-	output, err := json.Marshal(data)
+	if len(quality) != 0 {
+		t.Errorf("unexpected quality, got %v", quality)
+	}
+	/* Compare what would be published */
+	converter, _ := units.New(units.Metric, nil, nil)
+	published, _ := converter.Convert(data)
+
+	output, err := json.Marshal(published)
 	if err != nil {
 		t.Error("unexpected error")
 	}
@@ -74,3 +202,1306 @@ func TestNormalizeDataTestInput(t *testing.T) {
 		t.Errorf("unexpected error, output: %v, expected: %v", string(output), test.Output)
 	}
 }
+
+func TestNormalizeDataSentinels(t *testing.T) {
+	var tests = []struct {
+		key     string
+		value   int
+		field   string
+		quality string
+	}{
+		{"temperature", TemperatureError, "temp", QualitySensorError},
+		{"temperature", TemperatureInvalid, "temp", QualityInvalid},
+		{"temperature", TemperatureBelowMinimum, "temp", QualityBelowMinimum},
+		{"temperature", TemperatureAboveMaximum, "temp", QualityAboveMaximum},
+		{"humidity", HumidityError, "hum", QualitySensorError},
+		{"humidity", HumidityInvalid, "hum", QualityInvalid},
+		{"light", SunlightInvalid, "light", QualityInvalid},
+		{"light", SunlightInvalid + 1, "light", QualityOutOfRange},
+		{"light", -1, "light", QualityOutOfRange},
+		{"uv", UVIndexInvalid, "uv", QualityInvalid},
+		{"uv", UVIndexInvalid + 1, "uv", QualityOutOfRange},
+		{"uv", -1, "uv", QualityOutOfRange},
+	}
+
+	for _, test := range tests {
+		data, quality, err := normalizeData(map[string]interface{}{test.key: test.value})
+		if err != nil {
+			t.Errorf("%s 0x%X: unexpected error, err: %s", test.key, test.value, err)
+		}
+
+		if val, ok := data[test.field]; ok {
+			t.Errorf("%s 0x%X: expected %s to be suppressed, got %v", test.key, test.value, test.field, val)
+		}
+
+		if quality[test.field] != test.quality {
+			t.Errorf("%s 0x%X: expected quality %s, got %v", test.key, test.value, test.quality, quality)
+		}
+	}
+
+	/* The values either side of the sentinels are readings */
+	data, quality, _ := normalizeData(map[string]interface{}{
+		"temperature": TemperatureInvalid - 1,
+		"humidity":    HumidityInvalid - 1,
+		"light":       SunlightInvalid - 1,
+		"uv":          UVIndexInvalid - 1,
+	})
+	if len(data) != 4 || len(quality) != 0 {
+		t.Errorf("expected readings, got %v and %v", data, quality)
+	}
+}
+
+func TestSynthesizePsychrometrics(t *testing.T) {
+	var tests = []struct {
+		input  map[string]interface{}
+		output map[string]interface{}
+	}{
+		{
+			map[string]interface{}{"temp": 20.0, "hum": 50},
+			map[string]interface{}{"dewpoint": 9.26, "feels_like": 20.0},
+		},
+		{
+			map[string]interface{}{"temp": -10.0, "wspd": 10.0},
+			map[string]interface{}{"wind_chill": -20.3, "feels_like": nil},
+		},
+		{
+			map[string]interface{}{"temp": 10.0, "hum": 0},
+			map[string]interface{}{"dewpoint": nil, "wetbulb": nil},
+		},
+		{
+			map[string]interface{}{"hum": 50},
+			map[string]interface{}{"dewpoint": nil, "feels_like": nil},
+		},
+	}
+
+	for _, test := range tests {
+		synthesizePsychrometrics(test.input)
+
+		for key, expected := range test.output {
+			val, ok := test.input[key]
+
+			if expected == nil {
+				if ok {
+					t.Errorf("unexpected %s, got %v", key, val)
+				}
+			} else if !near(val, expected) {
+				t.Errorf("expected %s %v, got %v", key, expected, val)
+			}
+		}
+	}
+}
+
+func TestCalibrateData(t *testing.T) {
+	config := cfg.Config{
+		Calibration: map[string]map[string]cfg.Calibration{
+			"*":      {"temp": {Offset: -0.8, Multiplier: 1}},
+			"sensor": {"wdir": {Multiplier: 1, Rotation: 30}, "wspd": {Multiplier: 1.1}},
+			"vane":   {"wdir": {Multiplier: 1, Rotation: 29.6}},
+			"mast":   {"wdir": {Multiplier: 1, Rotation: -0.004}},
+		},
+		PublishRaw: true,
+	}
+
+	var tests = []struct {
+		sensor string
+		input  map[string]interface{}
+		output map[string]interface{}
+	}{
+		{
+			"other",
+			map[string]interface{}{"temp": 20.5, "wdir": 340, "hum": 50},
+			map[string]interface{}{"temp": 19.7, "temp_raw": 20.5, "wdir": 340, "hum": 50},
+		},
+		{
+			"sensor",
+			map[string]interface{}{"temp": 20.5, "wdir": 340, "wspd": 10.0},
+			map[string]interface{}{"temp": 19.7, "temp_raw": 20.5, "wdir": 10, "wdir_raw": 340, "wspd": 11.0, "wspd_raw": 10.0},
+		},
+		{
+			/* Whole directions that round up to 360 are north, the rest are
+			 * wrapped again once they are rounded to be published */
+			"vane",
+			map[string]interface{}{"temp": 20.5, "wdir": 330},
+			map[string]interface{}{"temp": 19.7, "temp_raw": 20.5, "wdir": 0, "wdir_raw": 330},
+		},
+		{
+			"mast",
+			map[string]interface{}{"temp": 20.5, "wdir": 0.0},
+			map[string]interface{}{"temp": 19.7, "temp_raw": 20.5, "wdir": 359.996, "wdir_raw": 0.0},
+		},
+	}
+
+	for _, test := range tests {
+		calibrateData(config, test.sensor, test.input)
+
+		if len(test.input) != len(test.output) {
+			t.Errorf("expected %v, got %v", test.output, test.input)
+		}
+
+		for key, expected := range test.output {
+			if val := test.input[key]; !near(val, expected) {
+				t.Errorf("expected %s %v, got %v", key, expected, val)
+			}
+		}
+	}
+}
+
+func TestHandleDataRejectsSpikes(t *testing.T) {
+	test, err := getTestData("test.json")
+	if err != nil {
+		t.Fatal("failed to load test data")
+	}
+
+	clk := &testClock{now: time.Unix(0, 0)}
+	stn := newStation(testConfig(), clk)
+
+	wxData, _, err := stn.handleData(test.Input)
+	if err != nil || len(wxData) != 1 {
+		t.Fatalf("expected only sensor data, got %v (%v)", wxData, err)
+	}
+
+	/* 0x0FA0 is 360F, well past what the sensor can report */
+	spike := make(map[string]interface{})
+	for key, val := range test.Input {
+		spike[key] = val
+	}
+	spike["temperature"] = 0x0FA0
+
+	clk.now = clk.now.Add(time.Minute)
+
+	wxData, _, err = stn.handleData(spike)
+	if err != nil || len(wxData) != 2 {
+		t.Fatalf("expected diagnostics and sensor data, got %v (%v)", wxData, err)
+	}
+
+	var diagnostics map[string]map[string]int
+	if err := json.Unmarshal(wxData[0].Data, &diagnostics); err != nil {
+		t.Errorf("unexpected error, err: %s", err)
+	}
+	if diagnostics["rejected"]["temp"] != 1 {
+		t.Errorf("expected a rejected temperature, got %v", diagnostics)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(wxData[1].Data, &data); err != nil {
+		t.Errorf("unexpected error, err: %s", err)
+	}
+	if _, ok := data["temp"]; ok {
+		t.Errorf("expected temperature to be dropped, got %v", data)
+	}
+	if quality, _ := data["quality"].(map[string]interface{}); quality["temp"] != QualityRejected {
+		t.Errorf("expected temperature quality to be rejected, got %v", data["quality"])
+	}
+}
+
+func TestHandleDataFlatline(t *testing.T) {
+	test, err := getTestData("test.json")
+	if err != nil {
+		t.Fatal("failed to load test data")
+	}
+
+	for _, format := range []string{payload.Flat, payload.Envelope} {
+		config := testConfig()
+		config.PayloadFormat = format
+
+		clk := &testClock{now: time.Unix(0, 0)}
+		stn := newStation(config, clk)
+
+		/* Saturated air, as in fog, isn't a stuck sensor */
+		input := make(map[string]interface{})
+		for k, v := range test.Input {
+			input[k] = v
+		}
+		input["humidity"] = 100
+
+		var wxData []mqtt.Data
+		for elapsed := time.Duration(0); elapsed <= 6*time.Hour; elapsed += 10 * time.Minute {
+			clk.now = time.Unix(0, 0).Add(elapsed)
+
+			wxData, _, err = stn.handleData(input)
+			if err != nil {
+				t.Fatalf("unexpected error, err: %s", err)
+			}
+
+			if (elapsed < 5*time.Hour) && (len(wxData) != 1) {
+				t.Fatalf("%s: expected only sensor data after %v, got %v", format, elapsed, wxData)
+			}
+		}
+
+		/* Nothing has changed for the flatline time */
+		sensorData := wxData[len(wxData)-1].Data
+
+		if format == payload.Flat {
+			var data map[string]interface{}
+			if err := json.Unmarshal(sensorData, &data); err != nil {
+				t.Fatalf("unexpected error, err: %s", err)
+			}
+
+			if data["temp"] != test.Output["temp"] {
+				t.Errorf("expected temperature to be published, got %v", data)
+			}
+			if quality, _ := data["quality"].(map[string]interface{}); (quality["temp"] != flatline.FlagFlatline) || (quality["hum"] != flatline.FlagFlatline) {
+				t.Errorf("expected temperature and humidity to be flatlined, got %v", data["quality"])
+			}
+			continue
+		}
+
+		var obs payload.Observation
+		if err := json.Unmarshal(sensorData, &obs); err != nil {
+			t.Fatalf("unexpected error, err: %s", err)
+		}
+
+		if field := obs.Fields["temp"]; (field.Value != test.Output["temp"]) || (field.Quality != flatline.FlagFlatline) {
+			t.Errorf("unexpected temperature %v", field)
+		}
+		if field := obs.Fields["light"]; field.Quality != payload.QualityGood {
+			t.Errorf("unexpected light %v", field)
+		}
+	}
+}
+
+func TestEndOfDay(t *testing.T) {
+	test, err := getTestData("test.json")
+	if err != nil {
+		t.Fatal("failed to load test data")
+	}
+
+	clk := &testClock{now: time.Date(2021, 7, 31, 12, 0, 0, 0, time.UTC)}
+	stn := newStation(testConfig(), clk)
+
+	if next := stn.nextDayEnd(); !next.Equal(time.Date(2021, 8, 1, 0, 0, 1, 0, time.UTC)) {
+		t.Errorf("unexpected end of day %v", next)
+	}
+
+	topic, _, err := stn.identify(test.Input)
+	if err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	if _, _, err := stn.handleData(test.Input); err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	/* The last day of the month closes the month as well */
+	clk.now = stn.nextDayEnd()
+	wxData := stn.endOfDay()
+
+	if len(wxData) != 2 {
+		t.Fatalf("expected daily and monthly summaries, got %v", wxData)
+	}
+
+	topics := map[string]bool{
+		mqtt.JoinTopic(topic, "summary", "daily"):   true,
+		mqtt.JoinTopic(topic, "summary", "monthly"): true,
+	}
+
+	for _, d := range wxData {
+		if !topics[d.Topic] || !d.Retain {
+			t.Errorf("unexpected summary on %s, retained %t", d.Topic, d.Retain)
+		}
+
+		var data map[string]interface{}
+		if err := json.Unmarshal(d.Data, &data); err != nil {
+			t.Errorf("unexpected error, err: %s", err)
+		}
+		if _, ok := data["temp_max"]; !ok {
+			t.Errorf("expected a temperature summary, got %v", data)
+		}
+	}
+
+	/* Nothing was heard today */
+	clk.now = stn.nextDayEnd()
+	if wxData := stn.endOfDay(); len(wxData) != 0 {
+		t.Errorf("expected no summaries, got %v", wxData)
+	}
+}
+
+func TestSynthesizeTrends(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	state := newSensorState(testConfig(), clk)
+
+	/* Temperature climbs 1C/h while humidity holds */
+	var data map[string]interface{}
+	for i := 0; i <= 30; i++ {
+		data = map[string]interface{}{"temp": 20.0 + float64(i)/60, "hum": 50}
+		synthesizeTrends(state, data)
+
+		if (i < 15) && (len(data) != 2) {
+			t.Errorf("unexpected trend after %d minutes, got %v", i, data)
+		}
+
+		clk.now = clk.now.Add(time.Minute)
+	}
+
+	expected := map[string]interface{}{
+		"temp_trend_1h": 1.0,
+		"temp_trend":    TrendRising,
+		"hum_trend_1h":  0.0,
+		"hum_trend":     TrendSteady,
+	}
+
+	for key, val := range expected {
+		if !near(data[key], val) {
+			t.Errorf("expected %s %v, got %v", key, val, data[key])
+		}
+	}
+
+	if _, ok := data["dewpoint_trend"]; ok {
+		t.Errorf("unexpected dewpoint trend, got %v", data)
+	}
+}
+
+func TestSynthesizeSolar(t *testing.T) {
+	clk := &testClock{now: time.Date(2021, 6, 21, 16, 0, 0, 0, time.UTC)}
+
+	config := testConfig()
+	config.Position = &cfg.Position{Latitude: 43.65, Longitude: -79.38}
+	config.SunshineFraction = 0.7
+
+	state := newSensorState(config, clk)
+
+	/* An hour of sun around noon */
+	var data map[string]interface{}
+	for i := 0; i <= 60; i++ {
+		data = map[string]interface{}{"solar": 800.0}
+		synthesizeSolar(state.solar, data)
+		clk.now = clk.now.Add(time.Minute)
+	}
+
+	if data["sunshine"] != true || data["sunshine_24hr"] != 1.0 {
+		t.Errorf("expected an hour of sunshine, got %v", data)
+	}
+	if data["insolation_24hr"] != 0.8 {
+		t.Errorf("expected 0.8kWh/m^2, got %v", data["insolation_24hr"])
+	}
+	if elev, _ := data["sun_elev"].(float64); elev < 60 {
+		t.Errorf("expected the sun to be high, got %v", data["sun_elev"])
+	}
+
+	/* Cloud */
+	data = map[string]interface{}{"solar": 200.0}
+	synthesizeSolar(state.solar, data)
+
+	if data["sunshine"] != false {
+		t.Errorf("expected no sunshine, got %v", data)
+	}
+
+	/* Without a position only the insolation can be worked out */
+	state = newSensorState(testConfig(), clk)
+	data = map[string]interface{}{"solar": 800.0}
+	synthesizeSolar(state.solar, data)
+
+	if len(data) != 2 {
+		t.Errorf("expected only insolation, got %v", data)
+	}
+}
+
+func TestSynthesizeET0(t *testing.T) {
+	clk := &testClock{now: time.Date(2021, 6, 21, 15, 0, 0, 0, time.UTC)}
+
+	config := testConfig()
+	config.Position = &cfg.Position{Latitude: 43.65, Longitude: -79.38, Elevation: 76}
+
+	stn := newStation(config, clk)
+	topic := mqtt.JoinTopic(tp.DefaultBase, "test")
+	state := stn.sensor(topic, "test")
+
+	newData := func() map[string]interface{} {
+		return map[string]interface{}{"temp": 25.0, "hum": 50, "wspd": 2.0, "solar": 800.0}
+	}
+
+	/* Nothing until the first hour is over */
+	var data map[string]interface{}
+	for i := 0; i < 60; i++ {
+		data = newData()
+		synthesizeET0(state.et0, data)
+		clk.now = clk.now.Add(time.Minute)
+	}
+
+	if _, ok := data["et0_today"]; ok {
+		t.Errorf("unexpected et0 during the first hour, got %v", data)
+	}
+
+	data = newData()
+	synthesizeET0(state.et0, data)
+
+	first, _ := data["et0_today"].(float64)
+	if (first < 0.3) || (first > 1) {
+		t.Errorf("expected et0 for a sunny hour, got %v", data["et0_today"])
+	}
+
+	for i := 0; i < 60; i++ {
+		clk.now = clk.now.Add(time.Minute)
+		data = newData()
+		synthesizeET0(state.et0, data)
+	}
+
+	if second, _ := data["et0_today"].(float64); second <= first {
+		t.Errorf("expected et0 to add up through the day, got %v then %v", first, second)
+	}
+
+	/* The summary has to have seen the day too for it to be closed */
+	state.summary.Update(newData())
+
+	clk.now = stn.nextDayEnd()
+	wxData := stn.endOfDay()
+
+	if len(wxData) != 1 {
+		t.Fatalf("expected a daily summary, got %v", wxData)
+	}
+
+	var daily map[string]interface{}
+	if err := json.Unmarshal(wxData[0].Data, &daily); err != nil {
+		t.Errorf("unexpected error, err: %s", err)
+	}
+
+	if daily["et0_method"] != string(et0.PenmanMonteith) {
+		t.Errorf("expected Penman-Monteith, got %v", daily)
+	}
+	if value, _ := daily["et0"].(float64); value <= 0 {
+		t.Errorf("expected a daily et0, got %v", daily["et0"])
+	}
+}
+
+func TestET0DayBoundary(t *testing.T) {
+	clk := &testClock{now: time.Date(2021, 6, 21, 22, 0, 0, 0, time.UTC)}
+
+	config := testConfig()
+	config.Position = &cfg.Position{Latitude: 43.65, Longitude: -79.38, Elevation: 76}
+
+	stn := newStation(config, clk)
+	topic := mqtt.JoinTopic(tp.DefaultBase, "test")
+	state := stn.sensor(topic, "test")
+
+	newData := func() map[string]interface{} {
+		return map[string]interface{}{"temp": 25.0, "hum": 30, "wspd": 4.0, "solar": 0.0}
+	}
+
+	/* The summary has to have seen the day too for it to be closed */
+	state.summary.Update(newData())
+
+	/* The last two hours of the day */
+	var data map[string]interface{}
+	for i := 0; i < 120; i++ {
+		data = newData()
+		synthesizeET0(state.et0, data)
+		clk.now = clk.now.Add(time.Minute)
+	}
+
+	/* Only 22:00 - 23:00 has ended */
+	before, _ := data["et0_today"].(float64)
+	if before <= 0 {
+		t.Fatalf("expected et0 for the first hour, got %v", data)
+	}
+
+	/* The new day starts with nothing, 23:00 - 24:00 goes to the day before */
+	data = newData()
+	synthesizeET0(state.et0, data)
+
+	if _, ok := data["et0_today"]; ok {
+		t.Errorf("unexpected et0 at the start of the day, got %v", data)
+	}
+
+	clk.now = clk.now.Add(time.Second)
+	wxData := stn.endOfDay()
+
+	if len(wxData) != 1 {
+		t.Fatalf("expected a daily summary, got %v", wxData)
+	}
+
+	var daily map[string]interface{}
+	if err := json.Unmarshal(wxData[0].Data, &daily); err != nil {
+		t.Errorf("unexpected error, err: %s", err)
+	}
+
+	if after, _ := daily["et0_hourly"].(float64); after <= before {
+		t.Errorf("expected the last hour in the day's et0, got %v then %v", before, daily["et0_hourly"])
+	}
+}
+
+func TestIrrigate(t *testing.T) {
+	clk := &testClock{now: time.Date(2021, 7, 24, 0, 0, 1, 0, time.UTC)}
+
+	config := testConfig()
+	config.IrrigationZones = map[string]cfg.Zone{
+		"lawn": {Sensor: AnySensor, Kc: 1, Capacity: 20, Depletion: 0.5},
+		"beds": {Sensor: "other/1", Kc: 1, Capacity: 20, Depletion: 0.5},
+	}
+
+	stn := newStation(config, clk)
+	topic := mqtt.JoinTopic(tp.DefaultBase, "test")
+	state := stn.sensor(topic, "test")
+	start := time.Date(2021, 7, 23, 0, 0, 0, 0, time.UTC)
+
+	/* Without et0 there is no balance */
+	if wxData := stn.irrigate(topic, state, start, map[string]interface{}{"rain": 1.0}); len(wxData) != 0 {
+		t.Errorf("expected no advice, got %v", wxData)
+	}
+
+	wxData := stn.irrigate(topic, state, start, map[string]interface{}{"rain": 1.0, "et0": 6.0})
+	if len(wxData) != 1 {
+		t.Fatalf("expected advice for the lawn, got %v", wxData)
+	}
+
+	if wxData[0].Topic != mqtt.JoinTopic(topic, IrrigationTopic, "lawn") || !wxData[0].Retain {
+		t.Errorf("unexpected advice on %s, retained %t", wxData[0].Topic, wxData[0].Retain)
+	}
+
+	var advice map[string]interface{}
+	if err := json.Unmarshal(wxData[0].Data, &advice); err != nil {
+		t.Errorf("unexpected error, err: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"date":           "2021-07-23",
+		"recommendation": irrigation.Skip,
+		"deficit":        5.0,
+		"allowed":        10.0,
+		"rain":           1.0,
+		"etc":            6.0,
+	}
+
+	for key, val := range expected {
+		if advice[key] != val {
+			t.Errorf("expected %s %v, got %v", key, val, advice[key])
+		}
+	}
+
+	/* Dry enough to need water the next day */
+	wxData = stn.irrigate(topic, state, start.AddDate(0, 0, 1), map[string]interface{}{"et0": 6.0})
+	if err := json.Unmarshal(wxData[0].Data, &advice); err != nil {
+		t.Errorf("unexpected error, err: %s", err)
+	}
+	if advice["recommendation"] != irrigation.Water || advice["deficit"] != 11.0 {
+		t.Errorf("expected to water 11mm, got %v", advice)
+	}
+}
+
+func TestSynthesizeWindDirection(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	state := newSensorState(testConfig(), clk)
+
+	/* Either side of north averages to north, not south */
+	var data map[string]interface{}
+	for _, wdir := range []float64{350, 10} {
+		data = map[string]interface{}{"wdir": wdir, "wspd": 2.0}
+		if _, err := synthesizeData(state, data); err != nil {
+			t.Fatalf("unexpected error, err: %s", err)
+		}
+		clk.now = clk.now.Add(time.Second)
+	}
+
+	if (data["wdir"] != 0.0) || (data["wdir_cardinal"] != "N") {
+		t.Errorf("expected north, got %v %v", data["wdir"], data["wdir_cardinal"])
+	}
+
+	/* The sensor doesn't say where its gust came from */
+	if _, ok := data["wdir_gust"]; ok {
+		t.Errorf("expected no gust direction, got %v", data["wdir_gust"])
+	}
+}
+
+func TestSynthesizeRainReset(t *testing.T) {
+	clk := &testClock{now: time.Date(2021, 7, 23, 12, 0, 0, 0, time.UTC)}
+	state := newSensorState(testConfig(), clk)
+
+	/* The gauge is reset after counting 1mm, then counts 0.4mm */
+	var data map[string]interface{}
+	for _, rain := range []float64{4.0, 5.0, 0.0, 0.4} {
+		data = map[string]interface{}{"rain_acc": rain}
+		if _, err := synthesizeData(state, data); err != nil {
+			t.Fatalf("unexpected error, err: %s", err)
+		}
+		clk.now = clk.now.Add(time.Minute)
+	}
+
+	for _, key := range []string{"rain_1hr", "rain_24hr"} {
+		if data[key] != 1.4 {
+			t.Errorf("expected %s 1.4, got %v", key, data[key])
+		}
+	}
+}
+
+func TestSynthesizeDegreeDays(t *testing.T) {
+	clk := &testClock{now: time.Date(2021, 7, 23, 0, 0, 0, 0, time.UTC)}
+	state := newSensorState(testConfig(), clk)
+
+	var data map[string]interface{}
+	for i := 0; i <= 6*60; i++ {
+		data = map[string]interface{}{"temp": 22.0}
+		synthesizeDegreeDays(state.degDays, data)
+		clk.now = clk.now.Add(time.Minute)
+	}
+
+	/* 6 hours is a quarter of a day */
+	expected := map[string]interface{}{
+		"gdd_today":          3.0,
+		"gdd_season":         3.0,
+		"hdd_today":          0.0,
+		"cdd_today":          1.0,
+		"cdd_season":         1.0,
+		"chill_hours_today":  0.0,
+		"chill_hours_season": 0.0,
+	}
+
+	for key, val := range expected {
+		if data[key] != val {
+			t.Errorf("expected %s %v, got %v", key, val, data[key])
+		}
+	}
+}
+
+func TestSynthesizeUV(t *testing.T) {
+	var tests = []struct {
+		uv     float64
+		risk   string
+		colour string
+		burn2  interface{}
+	}{
+		{0, "low", "#4EB400", nil},
+		{2.4, "low", "#4EB400", 69.0},
+		{2.5, "moderate", "#F7E400", 67.0},
+		{8, "very_high", "#D8001D", 21.0},
+		{11, "extreme", "#6B49C8", 15.0},
+	}
+
+	for _, test := range tests {
+		data := map[string]interface{}{"uv": test.uv}
+		synthesizeUV(data)
+
+		if data["uv_risk"] != test.risk || data["uv_colour"] != test.colour {
+			t.Errorf("%v: expected %s %s, got %v %v", test.uv, test.risk, test.colour, data["uv_risk"], data["uv_colour"])
+		}
+
+		/* Minutes are published whole */
+		if burn, ok := data["uv_burn_2"].(float64); ok {
+			data["uv_burn_2"] = gomath.Round(burn)
+		}
+
+		if data["uv_burn_2"] != test.burn2 {
+			t.Errorf("%v: expected type II to burn in %v minutes, got %v", test.uv, test.burn2, data["uv_burn_2"])
+		}
+	}
+}
+
+func TestHandleDataAlerts(t *testing.T) {
+	test, err := getTestData("test.json")
+	if err != nil {
+		t.Fatal("failed to load test data")
+	}
+
+	below := 25.0
+
+	config := testConfig()
+	config.AlertRules = map[string]cfg.AlertRule{
+		"cold": {Sensor: alert.AnySensor, Field: "temp", Below: &below},
+	}
+
+	clk := &testClock{now: time.Unix(0, 0)}
+	stn := newStation(config, clk)
+
+	wxData, raised, err := stn.handleData(test.Input)
+	if err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	if len(raised) != 1 || raised[0].Rule != "cold" || raised[0].State != alert.Raised {
+		t.Fatalf("expected the cold alert, got %v", raised)
+	}
+
+	last := wxData[len(wxData)-1]
+	if last.Topic != mqtt.JoinTopic(tp.DefaultBase, AlertsTopic) {
+		t.Errorf("expected the alert to be published, got %v", last.Topic)
+	}
+
+	var published alert.Alert
+	if err := json.Unmarshal(last.Data, &published); err != nil {
+		t.Errorf("unexpected error, err: %s", err)
+	}
+	if _, key, _ := stn.identify(test.Input); published.Rule != "cold" || published.Sensor != key || *published.Value != test.Output["temp"] {
+		t.Errorf("unexpected alert %v", published)
+	}
+
+	/* Still cold, nothing new to say */
+	clk.now = clk.now.Add(time.Minute)
+	if _, raised, _ = stn.handleData(test.Input); len(raised) != 0 {
+		t.Errorf("expected no alerts, got %v", raised)
+	}
+}
+
+func TestHandleDataUnits(t *testing.T) {
+	test, err := getTestData("test.json")
+	if err != nil {
+		t.Fatal("failed to load test data")
+	}
+
+	below := 100.0
+
+	config := testConfig()
+	config.Units = units.Imperial
+	config.UnitOverrides = map[string]string{"wspd": "km/h"}
+	config.AlertRules = map[string]cfg.AlertRule{
+		"cold": {Sensor: alert.AnySensor, Field: "temp", Below: &below},
+	}
+
+	stn := newStation(config, &testClock{now: time.Unix(0, 0)})
+
+	wxData, raised, err := stn.handleData(test.Input)
+	if err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	var data struct {
+		Temp  float64           `json:"temp"`
+		Wspd  float64           `json:"wspd"`
+		Units map[string]string `json:"units"`
+	}
+	if err := json.Unmarshal(wxData[0].Data, &data); err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	temp := test.Output["temp"].(float64)
+	wspd := test.Output["wspd"].(float64)
+
+	if gomath.Abs(data.Temp-(temp*9/5+32)) > 0.01 || gomath.Abs(data.Wspd-wspd*3.6) > 0.01 {
+		t.Errorf("expected %vC and %vm/s to be converted, got %v and %v", temp, wspd, data.Temp, data.Wspd)
+	}
+
+	if data.Units["temp"] != "F" || data.Units["wspd"] != "km/h" || data.Units["hum"] != "%" {
+		t.Errorf("unexpected units %v", data.Units)
+	}
+
+	/* Alerts are on the metric values */
+	if len(raised) != 1 || *raised[0].Value != temp {
+		t.Errorf("expected the alert to be on %vC, got %v", temp, raised)
+	}
+}
+
+func TestHandleDataEnvelope(t *testing.T) {
+	test, err := getTestData("test.json")
+	if err != nil {
+		t.Fatal("failed to load test data")
+	}
+
+	config := testConfig()
+	config.PayloadFormat = payload.Envelope
+	config.SensorAliases = map[string]string{"SwitchDoc_Labs_FT020T_AIO/0_000000": "garden"}
+	config.Receiver = "shed"
+
+	stn := newStation(config, &testClock{now: time.Unix(1627024546, 0).UTC()})
+
+	/* A temperature the sensor couldn't read */
+	input := make(map[string]interface{})
+	for k, v := range test.Input {
+		input[k] = v
+	}
+	input["temperature"] = 0x0FFF
+
+	wxData, _, err := stn.handleData(input)
+	if err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	var obs payload.Observation
+	if err := json.Unmarshal(wxData[0].Data, &obs); err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	if obs.Schema != payload.SchemaVersion || obs.Time != "2021-07-23T07:15:46Z" || obs.Timestamp != 1627024546 || obs.Source != "shed" {
+		t.Errorf("unexpected envelope %v", obs)
+	}
+
+	if obs.Sensor != (payload.Sensor{Model: "SwitchDoc Labs FT020T AIO", ID: "0", Alias: "garden"}) {
+		t.Errorf("unexpected sensor %v", obs.Sensor)
+	}
+
+	if field := obs.Fields["hum"]; field.Value != test.Output["hum"] || field.Unit != "%" || field.Quality != payload.QualityGood {
+		t.Errorf("unexpected humidity %v", field)
+	}
+
+	if field := obs.Fields["temp"]; field.Value != nil || field.Unit != "C" || field.Quality != QualitySensorError {
+		t.Errorf("unexpected temperature %v", field)
+	}
+
+	if record := obs.Records["today"]["hum_max"]; record.Value != test.Output["hum"] || record.Unit != "%" {
+		t.Errorf("unexpected records %v", obs.Records)
+	}
+}
+
+func TestHandleDataFieldTopics(t *testing.T) {
+	test, err := getTestData("test.json")
+	if err != nil {
+		t.Fatal("failed to load test data")
+	}
+
+	config := testConfig()
+	config.FieldTopics = payload.FieldTopicsOnly
+	config.FieldRetain = map[string]bool{AnyField: true, "hum": false}
+
+	clk := &testClock{now: time.Unix(0, 0)}
+	stn := newStation(config, clk)
+	topic, _, _ := stn.identify(test.Input)
+
+	published := func() map[string]mqtt.Data {
+		wxData, _, err := stn.handleData(test.Input)
+		if err != nil {
+			t.Fatalf("unexpected error, err: %s", err)
+		}
+
+		fields := make(map[string]mqtt.Data)
+		for _, d := range wxData {
+			if d.Topic == topic {
+				t.Errorf("expected only field topics, got the payload")
+			}
+			fields[strings.TrimPrefix(d.Topic, topic+"/")] = d
+		}
+		return fields
+	}
+
+	fields := published()
+
+	if d := fields["temp"]; string(d.Data) != "20.5" || !d.Retain {
+		t.Errorf("unexpected temperature %s", d.Data)
+	}
+
+	if d := fields["hum"]; string(d.Data) != "54" || d.Retain {
+		t.Errorf("unexpected humidity %s", d.Data)
+	}
+
+	if d := fields["temp_trend"]; d.Topic != "" {
+		t.Errorf("expected no trend yet, got %s", d.Data)
+	}
+
+	if _, ok := fields["records"]; ok {
+		t.Errorf("expected no records")
+	}
+
+	/* The readings haven't changed, only what adds up over time has */
+	clk.now = clk.now.Add(time.Minute)
+	if fields = published(); fields["temp"].Topic != "" || fields["hum"].Topic != "" || fields["wind_run_24hr"].Topic == "" {
+		t.Errorf("expected only the changes to be published, got %v", fields)
+	}
+
+	/* Until it is time to refresh */
+	clk.now = clk.now.Add(15 * time.Minute)
+	if fields = published(); fields["temp"].Topic == "" || fields["hum"].Topic == "" {
+		t.Errorf("expected everything to be published again, got %v", fields)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	test, err := getTestData("test.json")
+	if err != nil {
+		t.Fatal("failed to load test data")
+	}
+
+	config := testConfig()
+	config.HADiscovery = true
+
+	clk := &testClock{now: time.Unix(0, 0)}
+	stn := newStation(config, clk)
+
+	published := func(wxData []mqtt.Data) map[string]mqtt.Data {
+		messages := make(map[string]mqtt.Data)
+		for _, d := range wxData {
+			messages[d.Topic] = d
+		}
+		return messages
+	}
+
+	wxData, _, err := stn.handleData(test.Input)
+	if err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+	messages := published(wxData)
+
+	if d := messages[sensorTopic(test)+"/availability"]; string(d.Data) != ha.Online || !d.Retain {
+		t.Errorf("expected the sensor to be available, got %v", d)
+	}
+
+	var temp ha.Config
+	d := messages["homeassistant/sensor/SwitchDoc_Labs_FT020T_AIO_0_000000/temp/config"]
+	if err := json.Unmarshal(d.Data, &temp); err != nil || !d.Retain {
+		t.Fatalf("expected the temperature to be discovered, got %v (%v)", d, err)
+	}
+
+	if temp.StateTopic != sensorTopic(test) || temp.ValueTemplate != "{{ value_json.temp }}" || temp.DeviceClass != "temperature" ||
+		temp.StateClass != ha.Measurement || temp.Unit != "°C" || temp.UniqueID != "SwitchDoc_Labs_FT020T_AIO_0_000000_temp" {
+		t.Errorf("unexpected temperature config %v", temp)
+	}
+
+	if len(temp.Availability) != 2 || temp.Availability[0].Topic != "sensor/rtl_433/status" || temp.Availability[1].Topic != sensorTopic(test)+"/availability" {
+		t.Errorf("unexpected availability %v", temp.Availability)
+	}
+
+	if temp.Device.Identifiers[0] != "weather_sensor_bridge_SwitchDoc_Labs_FT020T_AIO_0_000000" || temp.Device.Model != "SwitchDoc Labs FT020T AIO" {
+		t.Errorf("unexpected device %v", temp.Device)
+	}
+
+	var rain ha.Config
+	if err := json.Unmarshal(messages["homeassistant/sensor/SwitchDoc_Labs_FT020T_AIO_0_000000/rain_acc/config"].Data, &rain); err != nil || rain.StateClass != ha.TotalIncreasing {
+		t.Errorf("expected rain to be a total, got %v (%v)", rain, err)
+	}
+
+	var batt ha.Config
+	if err := json.Unmarshal(messages["homeassistant/binary_sensor/SwitchDoc_Labs_FT020T_AIO_0_000000/batt/config"].Data, &batt); err != nil ||
+		batt.DeviceClass != "battery" || batt.ValueTemplate != "{{ 'true' if value_json.batt else 'false' }}" {
+		t.Errorf("unexpected battery config %v (%v)", batt, err)
+	}
+
+	/* Fields are only discovered once */
+	clk.now = clk.now.Add(time.Minute)
+	wxData, _, _ = stn.handleData(test.Input)
+	for topic := range published(wxData) {
+		if strings.HasPrefix(topic, "homeassistant/") || strings.HasSuffix(topic, "/availability") {
+			t.Errorf("unexpected discovery %s", topic)
+		}
+	}
+
+	/* Gone quiet */
+	clk.now = clk.now.Add(15 * time.Minute)
+	messages = published(stn.checkDiscovery())
+	if d := messages[sensorTopic(test)+"/availability"]; string(d.Data) != ha.Offline || len(messages) != 1 {
+		t.Errorf("expected the sensor to be unavailable, got %v", messages)
+	}
+
+	/* Gone */
+	clk.now = clk.now.Add(24 * time.Hour)
+	messages = published(stn.checkDiscovery())
+	if d, ok := messages["homeassistant/sensor/SwitchDoc_Labs_FT020T_AIO_0_000000/temp/config"]; !ok || len(d.Data) != 0 || !d.Retain {
+		t.Errorf("expected the temperature to be removed, got %v", d)
+	}
+
+	if len(stn.checkDiscovery()) != 0 {
+		t.Errorf("expected the sensor to only be removed once")
+	}
+
+	/* And back again */
+	wxData, _, _ = stn.handleData(test.Input)
+	if _, ok := published(wxData)["homeassistant/sensor/SwitchDoc_Labs_FT020T_AIO_0_000000/temp/config"]; !ok {
+		t.Errorf("expected the temperature to be discovered again")
+	}
+}
+
+func TestDiscoveryStateTopics(t *testing.T) {
+	var tests = []struct {
+		format      string
+		fieldTopics string
+		topic       string
+		template    string
+	}{
+		{payload.Flat, payload.FieldTopicsOff, "sensor/rtl_433/model", "{{ value_json.temp }}"},
+		{payload.Envelope, payload.FieldTopicsOff, "sensor/rtl_433/model", "{{ value_json.fields.temp.value }}"},
+		{payload.Flat, payload.FieldTopicsAlso, "sensor/rtl_433/model/temp", ""},
+	}
+
+	for _, test := range tests {
+		config := testConfig()
+		config.PayloadFormat = test.format
+		config.FieldTopics = test.fieldTopics
+
+		stn := newStation(config, &testClock{})
+
+		if topic, template := stn.stateTopic("sensor/rtl_433/model", "temp", ha.Sensor); topic != test.topic || template != test.template {
+			t.Errorf("%s %s: expected %s %s, got %s %s", test.format, test.fieldTopics, test.topic, test.template, topic, template)
+		}
+	}
+}
+
+func TestHomie(t *testing.T) {
+	test, err := getTestData("test.json")
+	if err != nil {
+		t.Fatal("failed to load test data")
+	}
+
+	config := testConfig()
+	config.Homie = true
+	config.Receiver = "shed"
+
+	stn := newStation(config, &testClock{now: time.Unix(0, 0)})
+
+	wxData, _, err := stn.handleData(test.Input)
+	if err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	var homieData []mqtt.Data
+	messages := make(map[string]string)
+	for _, d := range wxData {
+		if !strings.HasPrefix(d.Topic, "homie/") {
+			continue
+		}
+
+		if !d.Retain {
+			t.Errorf("expected %s to be retained", d.Topic)
+		}
+
+		homieData = append(homieData, d)
+		messages[d.Topic] = string(d.Data)
+	}
+
+	if len(homieData) == 0 {
+		t.Fatal("expected the sensor to be published to the Homie device")
+	}
+
+	/* The device is described between init and ready */
+	if first := homieData[0]; first.Topic != "homie/weather-sensor-bridge/$state" || string(first.Data) != homie.Init {
+		t.Errorf("expected the device to start in init, got %s %s", first.Topic, first.Data)
+	}
+
+	ready := -1
+	for i, d := range homieData {
+		if d.Topic == "homie/weather-sensor-bridge/$state" && string(d.Data) == homie.Ready {
+			ready = i
+		}
+	}
+	for _, d := range homieData[ready+1:] {
+		if strings.Contains(d.Topic, "$") {
+			t.Errorf("expected %s before the device is ready", d.Topic)
+		}
+	}
+
+	node := "homie/weather-sensor-bridge/switchdoc-labs-ft020t-aio-0-000000"
+
+	var expected = map[string]string{
+		"homie/weather-sensor-bridge/$homie": homie.Version,
+		"homie/weather-sensor-bridge/$name":  "shed",
+		"homie/weather-sensor-bridge/$nodes": "switchdoc-labs-ft020t-aio-0-000000",
+		node + "/$name":                      "SwitchDoc_Labs_FT020T_AIO/0_000000",
+		node + "/$type":                      "SwitchDoc Labs FT020T AIO",
+		node + "/temp/$datatype":             homie.Float,
+		node + "/temp/$unit":                 "°C",
+		node + "/temp":                       "20.5",
+		node + "/hum/$datatype":              homie.Integer,
+		node + "/hum/$unit":                  "%",
+		node + "/hum":                        "54",
+		node + "/batt/$datatype":             homie.Boolean,
+		node + "/batt":                       "false",
+		node + "/rain-acc/$name":             "rain acc",
+		node + "/rain-acc/$unit":             "mm",
+	}
+
+	for topic, value := range expected {
+		if messages[topic] != value {
+			t.Errorf("%s: expected %s, got %s", topic, value, messages[topic])
+		}
+	}
+
+	if properties := messages[node+"/$properties"]; !strings.Contains(properties, "rain-acc,") || strings.Contains(properties, "_") {
+		t.Errorf("unexpected properties %s", properties)
+	}
+
+	if _, ok := messages[node+"/batt/$unit"]; ok {
+		t.Errorf("expected the battery to have no unit")
+	}
+
+	/* Described sensors only publish their values */
+	wxData, _, _ = stn.handleData(test.Input)
+	for _, d := range wxData {
+		if strings.HasPrefix(d.Topic, "homie/") && strings.Contains(d.Topic, "$") {
+			t.Errorf("unexpected attribute %s", d.Topic)
+		}
+	}
+}
+
+func TestHandleDataDeadband(t *testing.T) {
+	test, err := getTestData("test.json")
+	if err != nil {
+		t.Fatal("failed to load test data")
+	}
+
+	config := testConfig()
+	config.Deadbands = map[string]cfg.Deadband{
+		"temp":            {Absolute: 0.5},
+		deadband.AnyField: {Percent: 10},
+	}
+
+	clk := &testClock{now: time.Unix(0, 0)}
+	stn := newStation(config, clk)
+
+	published := func(input map[string]interface{}) bool {
+		wxData, _, err := stn.handleData(input)
+		if err != nil {
+			t.Fatalf("unexpected error, err: %s", err)
+		}
+
+		for _, d := range wxData {
+			if d.Topic == sensorTopic(test) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	withReading := func(field string, value interface{}) map[string]interface{} {
+		input := make(map[string]interface{})
+		for k, v := range test.Input {
+			input[k] = v
+		}
+		input[field] = value
+		return input
+	}
+
+	if !published(test.Input) {
+		t.Errorf("expected the first reading to be published")
+	}
+
+	var tests = []struct {
+		name      string
+		field     string
+		value     interface{}
+		published bool
+	}{
+		{"nothing changed", "humidity", 54.0, false},
+		{"within the temperature deadband", "temperature", 1094.0, false},
+		{"within the humidity deadband", "humidity", 58.0, false},
+		{"beyond the temperature deadband", "temperature", 1100.0, true},
+		{"back within the deadband", "temperature", 1096.0, false},
+		{"beyond the humidity deadband", "humidity", 60.0, true},
+	}
+
+	input := test.Input
+	for _, test := range tests {
+		clk.now = clk.now.Add(time.Minute)
+		input = withReading(test.field, test.value)
+
+		if p := published(input); p != test.published {
+			t.Errorf("%s: expected %v, got %v", test.name, test.published, p)
+		}
+	}
+
+	/* Unchanged readings are published for the heartbeat */
+	clk.now = clk.now.Add(14 * time.Minute)
+	if published(input) {
+		t.Errorf("unexpected publish before the heartbeat")
+	}
+
+	clk.now = clk.now.Add(time.Minute)
+	if !published(input) {
+		t.Errorf("expected the heartbeat to be published")
+	}
+}
+
+func TestHandleDataTemplates(t *testing.T) {
+	test, err := getTestData("test.json")
+	if err != nil {
+		t.Fatal("failed to load test data")
+	}
+
+	config := testConfig()
+	config.SensorAliases = map[string]string{"SwitchDoc_Labs_FT020T_AIO/0_000000": "garden"}
+	config.Templates = map[string]cfg.PayloadTemplate{
+		"sign":    {Sensor: "SwitchDoc_Labs_FT020T_AIO/0_000000", Topic: "sign/cmnd/display", Template: "{{.alias}} {{round .temp 0}}{{.units.temp}} {{.hum}}%", Retain: true},
+		"tasmota": {Sensor: render.AnySensor, Topic: "{base}/{alias|model}/tasmota", Template: `{"Temp":{{json .temp}},"Sensor":"{{.sensor}}"}`},
+		"other":   {Sensor: "Acurite/1", Topic: "other", Template: "{{.temp}}"},
+	}
+
+	stn := newStation(config, &testClock{now: time.Unix(0, 0)})
+
+	messages := func() map[string]mqtt.Data {
+		wxData, _, err := stn.handleData(test.Input)
+		if err != nil {
+			t.Fatalf("unexpected error, err: %s", err)
+		}
+
+		messages := make(map[string]mqtt.Data)
+		for _, d := range wxData {
+			messages[d.Topic] = d
+		}
+		return messages
+	}
+
+	published := messages()
+
+	if d := published["sign/cmnd/display"]; string(d.Data) != "garden 21C 54%" || !d.Retain {
+		t.Errorf("unexpected sign payload %v", d)
+	}
+
+	if d := published["sensor/rtl_433/garden/tasmota"]; string(d.Data) != `{"Temp":20.5,"Sensor":"SwitchDoc_Labs_FT020T_AIO/0_000000"}` || d.Retain {
+		t.Errorf("unexpected tasmota payload %v", d)
+	}
+
+	if _, ok := published["other"]; ok {
+		t.Errorf("expected the template for another sensor not to be published")
+	}
+
+	if _, ok := published[sensorTopic(test)]; !ok {
+		t.Errorf("expected the sensor's data alongside the templates")
+	}
+
+	stn.cfg.TemplatesOnly = true
+	published = messages()
+
+	if _, ok := published[sensorTopic(test)]; ok {
+		t.Errorf("expected only the templates to be published")
+	}
+
+	if _, ok := published["sign/cmnd/display"]; !ok {
+		t.Errorf("expected the templates to be published")
+	}
+}
+
+func TestCheckTemplates(t *testing.T) {
+	var tests = []struct {
+		template string
+		valid    bool
+	}{
+		{"{{round .temp 1}} {{.wspd_2m}}", true},
+		{"{{.rain_event_acc}}", true},
+		{"{{round .units 1}}", false},
+		{"{{index .temp 1}}", false},
+	}
+
+	for _, test := range tests {
+		config := testConfig()
+		config.Templates = map[string]cfg.PayloadTemplate{
+			"test": {Sensor: render.AnySensor, Topic: "{base}/{model}/test", Template: test.template},
+		}
+
+		if err := CheckTemplates(config); (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.template, test.valid, err)
+		}
+	}
+}
+
+func TestHandleDataEncoding(t *testing.T) {
+	test, err := getTestData("test.json")
+	if err != nil {
+		t.Fatal("failed to load test data")
+	}
+
+	config := testConfig()
+	config.Encoding = encoder.MessagePack
+	config.FieldTopics = payload.FieldTopicsAlso
+
+	stn := newStation(config, &testClock{now: time.Unix(0, 0)})
+
+	wxData, _, err := stn.handleData(test.Input)
+	if err != nil {
+		t.Fatalf("unexpected error, err: %s", err)
+	}
+
+	for _, d := range wxData {
+		if d.Topic != sensorTopic(test) {
+			/* Field topics are plain values whatever the encoding */
+			if len(d.ContentType) > 0 {
+				t.Errorf("%s: unexpected content type %s", d.Topic, d.ContentType)
+			}
+			continue
+		}
+
+		if d.ContentType != encoder.MessagePackContentType {
+			t.Errorf("expected the msgpack content type, got %s", d.ContentType)
+		}
+
+		var decoded map[string]interface{}
+		if err := msgpack.Unmarshal(d.Data, &decoded); err != nil {
+			t.Fatalf("unexpected error, err: %s", err)
+		}
+
+		if decoded["temp"] != 20.5 || decoded["batt"] != false {
+			t.Errorf("unexpected payload %v", decoded)
+		}
+	}
+}
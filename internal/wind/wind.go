@@ -0,0 +1,162 @@
+package wind
+
+import (
+	"math"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+)
+
+// Upper limit, in m/s, of each Beaufort number. Anything above the last is 12.
+var beaufortLimits = []float64{0.5, 1.6, 3.4, 5.5, 8.0, 10.8, 13.9, 17.2, 20.8, 24.5, 28.5, 32.7}
+
+var beaufortDescriptions = []string{
+	"Calm",
+	"Light air",
+	"Light breeze",
+	"Gentle breeze",
+	"Moderate breeze",
+	"Fresh breeze",
+	"Strong breeze",
+	"Near gale",
+	"Gale",
+	"Strong gale",
+	"Storm",
+	"Violent storm",
+	"Hurricane force",
+}
+
+var cardinalPoints = []string{
+	"N", "NNE", "NE", "ENE",
+	"E", "ESE", "SE", "SSE",
+	"S", "SSW", "SW", "WSW",
+	"W", "WNW", "NW", "NNW",
+}
+
+// Gust tracks the strongest gust over a window along with the direction the
+// wind was coming from at the time
+type Gust struct {
+	acc *acc.Accumulator
+}
+
+// NewGust creates a gust tracker over the window of the accumulator
+func NewGust(window *acc.Accumulator) *Gust {
+	gust := Gust{
+		acc: window,
+	}
+
+	return &gust
+}
+
+// Update adds a gust speed (m/s) and direction (degrees) and returns the
+// strongest gust over the window with its direction. Use NaN for an unknown
+// direction, the bool will be false if the strongest gust has no direction.
+func (g *Gust) Update(speed float64, direction float64) (float64, float64, bool, error) {
+	stats, err := g.acc.AccumulateTagged(speed, direction)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	return stats.Maximum, stats.MaximumTag, !math.IsNaN(stats.MaximumTag), nil
+}
+
+// Direction tracks the mean direction the wind is coming from over a window.
+// It is the direction of the mean of the directions as unit vectors, so that
+// 350 and 10 average to 0 rather than 180.
+type Direction struct {
+	sin *acc.Accumulator
+	cos *acc.Accumulator
+}
+
+// NewDirection creates a direction tracker over the windows of the
+// accumulators, which must be the same
+func NewDirection(sin *acc.Accumulator, cos *acc.Accumulator) *Direction {
+	direction := Direction{
+		sin: sin,
+		cos: cos,
+	}
+
+	return &direction
+}
+
+// Update adds a direction (degrees) and returns the mean direction over the
+// window, in [0, 360). The bool will be false if the directions cancel out and
+// there is no mean.
+func (d *Direction) Update(direction float64) (float64, bool, error) {
+	rad := direction * math.Pi / 180
+
+	sStats, err := d.sin.Accumulate(math.Sin(rad))
+	if err != nil {
+		return 0, false, err
+	}
+
+	cStats, err := d.cos.Accumulate(math.Cos(rad))
+	if err != nil {
+		return 0, false, err
+	}
+
+	/* Allow for the rounding of the sums */
+	if math.Hypot(sStats.Average, cStats.Average) < 1e-9 {
+		return 0, false, nil
+	}
+
+	mean := math.Atan2(sStats.Average, cStats.Average) * 180 / math.Pi
+	if mean < 0 {
+		mean += 360
+	}
+
+	return mean, true, nil
+}
+
+// Run tracks the wind run, the distance the air has travelled past the sensor,
+// over a window
+type Run struct {
+	acc *acc.Accumulator
+}
+
+// NewRun creates a wind run tracker over the window of the accumulator
+func NewRun(window *acc.Accumulator) *Run {
+	run := Run{
+		acc: window,
+	}
+
+	return &run
+}
+
+// Update adds a wind speed (m/s) and returns the wind run (km) over the window
+func (r *Run) Update(speed float64) (float64, error) {
+	stats, err := r.acc.Accumulate(speed)
+	if err != nil {
+		return 0, err
+	}
+
+	/* m/s integrated over seconds is m */
+	return stats.Integral / 1000, nil
+}
+
+// Beaufort returns the Beaufort number and its description for a wind speed
+// (m/s)
+func Beaufort(speed float64) (int, string) {
+	for number, limit := range beaufortLimits {
+		if speed < limit {
+			return number, beaufortDescriptions[number]
+		}
+	}
+
+	number := len(beaufortLimits)
+
+	return number, beaufortDescriptions[number]
+}
+
+// Cardinal returns the 16 point compass direction for a direction in degrees
+func Cardinal(direction float64) string {
+	direction = math.Mod(direction, 360)
+	if direction < 0 {
+		direction += 360
+	}
+
+	/* Each point covers 22.5 degrees centred on it, so offset by half a point
+	 * to have N cover 348.75 -> 11.25 */
+	idx := int((direction+11.25)/22.5) % len(cardinalPoints)
+
+	return cardinalPoints[idx]
+}
@@ -0,0 +1,160 @@
+package wind
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	acc "github.com/geoff-coppertop/weather-sensor-bridge/internal/accumulator"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func TestBeaufort(t *testing.T) {
+	var tests = []struct {
+		speed       float64
+		number      int
+		description string
+	}{
+		{0.0, 0, "Calm"},
+		{0.5, 1, "Light air"},
+		{5.4, 3, "Gentle breeze"},
+		{20.8, 9, "Strong gale"},
+		{32.6, 11, "Violent storm"},
+		{32.7, 12, "Hurricane force"},
+		{60.0, 12, "Hurricane force"},
+	}
+
+	for _, test := range tests {
+		number, description := Beaufort(test.speed)
+
+		if number != test.number || description != test.description {
+			t.Errorf("%v m/s: expected %d (%s), got %d (%s)", test.speed, test.number, test.description, number, description)
+		}
+	}
+}
+
+func TestCardinal(t *testing.T) {
+	var tests = []struct {
+		direction float64
+		cardinal  string
+	}{
+		{0.0, "N"},
+		{11.2, "N"},
+		{11.25, "NNE"},
+		{45.0, "NE"},
+		{180.0, "S"},
+		{250.0, "WSW"},
+		{348.75, "N"},
+		{359.0, "N"},
+		{360.0, "N"},
+		{-90.0, "W"},
+	}
+
+	for _, test := range tests {
+		if cardinal := Cardinal(test.direction); cardinal != test.cardinal {
+			t.Errorf("%v degrees: expected %s, got %s", test.direction, test.cardinal, cardinal)
+		}
+	}
+}
+
+func TestGust(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	gust := NewGust(acc.New(10*time.Minute, clk, acc.ROLLING))
+
+	testData := []struct {
+		speed     float64
+		direction float64
+		delay     time.Duration
+		maxSpeed  float64
+		maxDir    float64
+		dirOk     bool
+	}{
+		{5.0, 90.0, 0, 5.0, 90.0, true},
+		{8.0, 180.0, time.Minute, 8.0, 180.0, true},
+		{6.0, 270.0, time.Minute, 8.0, 180.0, true},
+		{9.0, math.NaN(), time.Minute, 9.0, 0.0, false},
+		{4.0, 0.0, 11 * time.Minute, 4.0, 0.0, true},
+	}
+
+	for _, test := range testData {
+		clk.now = clk.now.Add(test.delay)
+
+		maxSpeed, maxDir, dirOk, err := gust.Update(test.speed, test.direction)
+		if err != nil {
+			t.Errorf("unexpected error, err: %s", err)
+		}
+
+		if maxSpeed != test.maxSpeed || dirOk != test.dirOk || (dirOk && maxDir != test.maxDir) {
+			t.Errorf("expected %v @ %v (%v), got %v @ %v (%v)", test.maxSpeed, test.maxDir, test.dirOk, maxSpeed, maxDir, dirOk)
+		}
+	}
+}
+
+func TestDirection(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	newWindow := func() *acc.Accumulator {
+		return acc.New(2*time.Minute, clk, acc.ROLLING)
+	}
+
+	var tests = []struct {
+		directions []float64
+		mean       float64
+		ok         bool
+	}{
+		{[]float64{90}, 90, true},
+		{[]float64{350, 10}, 0, true},
+		{[]float64{340, 0, 20}, 0, true},
+		{[]float64{180, 270}, 225, true},
+		{[]float64{0, 180}, 0, false},
+	}
+
+	for _, test := range tests {
+		direction := NewDirection(newWindow(), newWindow())
+
+		var mean float64
+		var ok bool
+		for _, d := range test.directions {
+			mean, ok, _ = direction.Update(d)
+			clk.now = clk.now.Add(time.Second)
+		}
+
+		if ok != test.ok {
+			t.Errorf("%v: expected %v, got %v", test.directions, test.ok, ok)
+		}
+
+		if ok && (math.Abs(math.Mod(mean-test.mean+180, 360)-180) > 1e-9) {
+			t.Errorf("%v: expected %v, got %v", test.directions, test.mean, mean)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	clk := &testClock{now: time.Unix(0, 0)}
+	run := NewRun(acc.New(24*time.Hour, clk, acc.CONSECUTIVE))
+
+	if km, _ := run.Update(10.0); km != 0 {
+		t.Errorf("expected no wind run from a single sample, got %v", km)
+	}
+
+	clk.now = clk.now.Add(time.Hour)
+
+	/* An average of 5m/s for an hour is 18km */
+	if km, _ := run.Update(0.0); km != 18.0 {
+		t.Errorf("expected 18km, got %v", km)
+	}
+
+	/* Samples that come closer together don't count for more, a minute going
+	 * from calm back up to 10m/s adds 0.45km */
+	clk.now = clk.now.Add(30 * time.Second)
+	run.Update(10.0)
+	clk.now = clk.now.Add(30 * time.Second)
+
+	if km, _ := run.Update(10.0); math.Abs(km-18.45) > 1e-9 {
+		t.Errorf("expected 18.45km, got %v", km)
+	}
+}